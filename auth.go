@@ -0,0 +1,60 @@
+package dbgp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// Authentication is an optional extension of the protocol guarding engines
+// that can execute arbitrary code. An engine with a secret adds a random
+// x_challenge attribute to its init packet and only accepts
+//
+//	x_auth -i 1 -- <response>
+//
+// as the first command, where response is the base64 encoded AuthResponse of
+// the shared secret, the challenge and the idekey and session of the init
+// packet. Any other
+// command, or a wrong response, closes the connection.
+
+// ErrAuthentication is returned by Conn.Run when the IDE failed to
+// authenticate
+var ErrAuthentication = errors.New("dbgp: authentication failed")
+
+// AuthResponse computes the x_auth response to a challenge: the hex encoded
+// HMAC-SHA256 of the challenge, IDE key and session keyed with the secret
+func AuthResponse(secret, challenge, ideKey, session string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, s := range []string{challenge, ideKey, session} {
+		mac.Write([]byte(s))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newChallenge() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// authenticate checks the first command of a connection
+func (c *Conn) authenticate(r *Request) error {
+	if r.Command != "x_auth" {
+		return ErrAuthRequired
+	}
+	response, err := base64.StdEncoding.DecodeString(r.Data)
+	if err != nil {
+		return ErrAuthFailed
+	}
+	want := AuthResponse(c.Secret, c.challenge, c.info.IDeKey, c.info.Session)
+	if !hmac.Equal(response, []byte(want)) {
+		return ErrAuthFailed
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package dbgp_test
+
+import (
+	"context"
+	"github.com/traviscline/dbgp"
+	"net"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	for _, tt := range []struct {
+		secret string
+		want   error // returned by the engine's Conn
+	}{
+		{"s3cret", nil},
+		{"guess", dbgp.ErrAuthentication},
+		{"", dbgp.ErrAuthentication},
+	} {
+		ideSide, engineSide := net.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			conn := dbgp.NewConn(engineSide, blockingClient{})
+			conn.Secret = "s3cret"
+			done <- conn.Run()
+			engineSide.Close()
+		}()
+		r, err := dbgp.NewRemote(ideSide)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.Authenticate(tt.secret)
+		if (err == nil) != (tt.want == nil) {
+			t.Errorf("secret %q: Authenticate returned %v", tt.secret, err)
+		}
+		if err == nil {
+			if _, err := r.Status(context.Background()); err != nil {
+				t.Errorf("secret %q: status after authenticating: %v", tt.secret, err)
+			}
+		}
+		ideSide.Close()
+		if err := <-done; err != tt.want {
+			t.Errorf("secret %q: engine conn returned %v, want %v", tt.secret, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package dbgp
+
+import (
+	"context"
+	"github.com/golang/glog"
+)
+
+// addBreakpoint records a breakpoint set by the IDE, leaving its hit
+// condition to the client if it can evaluate it
+func (c *Conn) addBreakpoint(ctx context.Context, bp *Breakpoint) error {
+	c.breakpoints[bp.ID] = bp
+	if bp.HitValue == 0 {
+		return nil
+	}
+	hs, ok := c.client.(HitConditionSetter)
+	if !ok {
+		return nil
+	}
+	condition := bp.HitCondition
+	if condition == "" {
+		condition = ">="
+	}
+	native, err := hs.SetHitCondition(ctx, bp.ID, bp.HitValue, condition)
+	if err != nil {
+		return err
+	}
+	c.nativeHits[bp.ID] = native
+	return nil
+}
+
+// forgetBreakpoint drops a breakpoint the IDE removed or the engine deleted,
+// such as a watchpoint whose scope the program left
+func (c *Conn) forgetBreakpoint(id int) {
+	delete(c.breakpoints, id)
+	delete(c.nativeHits, id)
+	delete(c.nativeLogs, id)
+}
+
+// hit counts the hit of the breakpoint the program stopped at, if any, and
+// reports whether the program is to stay stopped
+func (c *Conn) hit(ctx context.Context, status string) bool {
+	sr, ok := c.client.(StopReporter)
+	if !ok || status != "break" {
+		return true
+	}
+	m := sr.LastStop()
+	if m == nil || m.BreakpointID == 0 {
+		return true
+	}
+	bp, ok := c.breakpoints[m.BreakpointID]
+	if !ok {
+		return true
+	}
+	bp.HitCount++
+	if c.nativeHits[bp.ID] {
+		// the client skipped the hits not meeting the condition
+		for i := 0; i < bp.HitValue && !bp.HitConditionMet(); i++ {
+			bp.HitCount++
+		}
+		return true
+	}
+	if !bp.HitConditionMet() {
+		glog.V(1).Infoln("breakpoint", bp.ID, "hit", bp.HitCount, "times, resuming")
+		return false
+	}
+	if bp.LogMessage != "" && !c.nativeLogs[bp.ID] {
+		note := Notification{Name: "x_log", BreakpointID: bp.ID, Text: c.logMessage(ctx, bp.LogMessage)}
+		if err := c.writeNotification(note); err != nil {
+			glog.Errorln("logging breakpoint", bp.ID, "failed:", err)
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package dbgp_test
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/dbgptest"
+	"testing"
+)
+
+func TestHitConditionMet(t *testing.T) {
+	for _, tt := range []struct {
+		condition    string
+		value, count int
+		want         bool
+	}{
+		{"", 0, 1, true},
+		{"==", 0, 1, true},
+		{"%", 0, 1, true},
+		{"", 3, 2, false},
+		{"", 3, 3, true},
+		{"", 3, 4, true},
+		{">=", 3, 2, false},
+		{">=", 3, 3, true},
+		{">=", 3, 4, true},
+		{"==", 3, 2, false},
+		{"==", 3, 3, true},
+		{"==", 3, 4, false},
+		{"%", 3, 1, false},
+		{"%", 3, 3, true},
+		{"%", 3, 5, false},
+		{"%", 3, 6, true},
+		{"%", 1, 7, true},
+	} {
+		bp := dbgp.Breakpoint{HitCondition: tt.condition, HitValue: tt.value, HitCount: tt.count}
+		if got := bp.HitConditionMet(); got != tt.want {
+			t.Errorf("hit %d of %q %d: got %v, want %v", tt.count, tt.condition, tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestHitCondition has Conn resume the fake engine until the hit condition
+// is met
+func TestHitCondition(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want int // hit_count after the first run
+	}{
+		{nil, 1},
+		{[]string{"-h", "3"}, 3},
+		{[]string{"-h", "3", "-o", ">="}, 3},
+		{[]string{"-h", "3", "-o", "=="}, 3},
+		{[]string{"-h", "2", "-o", "%"}, 2},
+		{[]string{"-h", "0", "-o", "=="}, 1},
+	} {
+		var stops []dbgptest.Stop
+		for i := 0; i < 5; i++ {
+			stops = append(stops, dbgptest.Stop{Message: &dbgp.Message{BreakpointID: 1, Lineno: 3}})
+		}
+		ide, err := dbgptest.NewIDE(dbgptest.NewEngine(stops...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := append([]string{"-t", "line", "-f", "file:///src/main.c", "-n", "3"}, tt.args...)
+		for _, cmd := range []struct {
+			name string
+			args []string
+		}{
+			{"breakpoint_set", args},
+			{"run", nil},
+		} {
+			resp, err := ide.Command(cmd.name, cmd.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error != nil {
+				t.Fatalf("%s %q: %v", cmd.name, cmd.args, resp.Error)
+			}
+		}
+		resp, err := ide.Command("breakpoint_get", "-d", "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var bp struct {
+			Breakpoint dbgp.Breakpoint `xml:"breakpoint"`
+		}
+		if err := xml.Unmarshal(resp.Raw, &bp); err != nil {
+			t.Fatal(err)
+		}
+		if got := bp.Breakpoint.HitCount; got != tt.want {
+			t.Errorf("%q: hit_count %d after run, want %d", tt.args, got, tt.want)
+		}
+		ide.Close()
+	}
+}
+
+// TestBreakpointDeleted forgets breakpoints the engine deleted, also when
+// the IDE did not enable notifications
+func TestBreakpointDeleted(t *testing.T) {
+	for _, notify := range []bool{false, true} {
+		ide, err := dbgptest.NewIDE(dbgptest.NewEngine(dbgptest.Stop{
+			Notifications: []dbgp.Notification{{Name: "x_breakpoint_deleted", BreakpointID: 1, Text: "watchpoint 1 left its scope"}},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmds := [][]string{
+			{"breakpoint_set", "-t", "watch", "--", "eA=="},
+			{"breakpoint_get", "-d", "1"},
+			{"run"},
+		}
+		if notify {
+			cmds = append([][]string{{"feature_set", "-n", "notify_ok", "-v", "1"}}, cmds...)
+		}
+		for _, cmd := range cmds {
+			resp, err := ide.Command(cmd[0], cmd[1:]...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error != nil {
+				t.Fatalf("%q: %v", cmd, resp.Error)
+			}
+		}
+		resp, err := ide.Command("breakpoint_get", "-d", "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error == nil || resp.Error.Code != 205 {
+			t.Errorf("notify %v: breakpoint_get of a deleted breakpoint returned %s", notify, resp.Raw)
+		}
+		ide.Close()
+	}
+}
+
+// uncountingClient sets breakpoints but does not report where it stopped
+type uncountingClient struct {
+	blockingClient
+}
+
+func (uncountingClient) BreakpointSet(ctx context.Context, bpType, fileName string, line int) (dbgp.Breakpoint, error) {
+	return dbgp.Breakpoint{ID: 1, State: "enabled"}, nil
+}
+
+// TestHitConditionUnsupported refuses hit conditions nobody could evaluate
+func TestHitConditionUnsupported(t *testing.T) {
+	ide, err := dbgptest.NewIDE(uncountingClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ide.Close()
+
+	for _, tt := range []struct {
+		args []string
+		code int // of the error, 0 for none
+	}{
+		{nil, 0},
+		{[]string{"-h", "0", "-o", "=="}, 0},
+		{[]string{"-h", "3"}, 3},
+		{[]string{"-h", "2", "-o", "%"}, 3},
+	} {
+		args := append([]string{"-t", "line", "-f", "file:///src/main.go", "-n", "3"}, tt.args...)
+		resp, err := ide.Command("breakpoint_set", args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := 0
+		if resp.Error != nil {
+			code = resp.Error.Code
+		}
+		if code != tt.code {
+			t.Errorf("breakpoint_set %q: got error code %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
+
+func TestBreakpointRemove(t *testing.T) {
+	engine := dbgptest.NewEngine()
+	ide, err := dbgptest.NewIDE(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ide.Close()
+
+	for _, tt := range []struct {
+		args []string
+		code int // of the error, 0 for none
+	}{
+		{[]string{"breakpoint_set", "-t", "line", "-f", "file:///src/main.c", "-n", "3"}, 0},
+		{[]string{"breakpoint_remove", "-d", "1"}, 0},
+		{[]string{"breakpoint_get", "-d", "1"}, 205},
+		{[]string{"breakpoint_remove", "-d", "1"}, 205},
+	} {
+		resp, err := ide.Command(tt.args[0], tt.args[1:]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := 0
+		if resp.Error != nil {
+			code = resp.Error.Code
+		}
+		if code != tt.code {
+			t.Errorf("%q: got error code %d, want %d", tt.args, code, tt.code)
+		}
+	}
+	if bps := engine.Breakpoints(); len(bps) != 0 {
+		t.Errorf("engine still has breakpoints %+v", bps)
+	}
+}
@@ -5,30 +5,103 @@
 // status: pre-alpha
 package dbgp
 
-// The DBGPClient interface captures what a client implementation must provide
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// DBGPClient is the core every client implementation must provide. The
+// commands of the protocol are served through the optional capability
+// interfaces below, which Conn detects with type assertions: commands of
+// capabilities a client lacks are answered with ErrUnimplemented and reported
+// as unsupported by feature_get.
+//
+// Methods take the context of the command, which is cancelled when it times
+// out or the connection is closed, and errors are answered with DBGP error
+// responses. Continuation commands report problems of the program itself,
+// such as it having exited, with status and reason; their error is for
+// failures of the engine.
 type DBGPClient interface {
 	// Init is called when starting communication with upstream
-	Init() InitResponse
+	Init(ctx context.Context) (InitResponse, error)
 	// Return status, one of ("starting", "stopping", "running", "break")
-	Status() string
+	Status(ctx context.Context) (string, error)
+}
+
+// FeatureReporter reports the features of the engine for feature_get
+type FeatureReporter interface {
 	// Return supported features (called after Init())
 	Features() Features
+}
+
+// Stepper steps through the program for step_into and step_over
+type Stepper interface {
 	// Step the debugger into the program. State being one of ("starting", "stopping", "running", "break"), and reason one of ("ok, "error", "aborted", "exception")
-	StepInto() (status string, reason string)
+	StepInto(ctx context.Context) (status string, reason string, err error)
 	// Step over the program. State being one of ("starting", "stopping", "running", "break"), and reason one of ("ok, "error", "aborted", "exception")
-	StepOver() (status string, reason string)
+	StepOver(ctx context.Context) (status string, reason string, err error)
+}
+
+// Runner runs the program for run
+type Runner interface {
+	// Run the program until it hits a breakpoint or ends. State being one of ("starting", "stopping", "running", "break"), and reason one of ("ok, "error", "aborted", "exception")
+	Run(ctx context.Context) (status string, reason string, err error)
+}
+
+// StackInspector returns the call stack for stack_depth and stack_get
+type StackInspector interface {
 	// Return the maximum stack depth
-	StackDepth() int
+	StackDepth(ctx context.Context) (int, error)
 	// Return one or more Stack elements based on the requested depth
-	StackGet(depth int) ([]Stack, error)
+	StackGet(ctx context.Context, depth int) ([]Stack, error)
+}
+
+// Evaluator inspects the variables of the program for context_names,
+// context_get and property_get
+type Evaluator interface {
 	// Return the relevant Contexts
-	ContextNames(depth int) ([]Context, error)
+	ContextNames(ctx context.Context, depth int) ([]Context, error)
 	// Return the properties associated with the specified stack depth and context
-	ContextGet(depth, context int) ([]Property, error)
-	// Return the value for a property
-	PropertyGet(depth, context int, name string) (string, error)
-	// Set a breakpoint
-	BreakpointSet(bpType, fileName string, line int) (Breakpoint, error)
+	ContextGet(ctx context.Context, depth, context int) ([]Property, error)
+	// Return a property, including its value and any children
+	PropertyGet(ctx context.Context, depth, context int, name string) (Property, error)
+}
+
+// PropertySetter changes variables of the program for property_set
+type PropertySetter interface {
+	// Set a property to a value, given in the language of the program
+	PropertySet(ctx context.Context, depth, context int, name, value string) error
+}
+
+// BreakpointManager sets breakpoints for breakpoint_set
+type BreakpointManager interface {
+	// Set a breakpoint. fileName is an engine side path, already translated by
+	// the Conn's PathMap
+	BreakpointSet(ctx context.Context, bpType, fileName string, line int) (Breakpoint, error)
+}
+
+// BreakpointRemover removes breakpoints for breakpoint_remove
+type BreakpointRemover interface {
+	// Remove a breakpoint of any type, given by the ID the client set it with
+	BreakpointRemove(ctx context.Context, id int) error
+}
+
+// StreamRedirector redirects the output of the program to the IDE for the
+// stdout and stderr commands
+type StreamRedirector interface {
+	// Redirect "stdout" or "stderr" of the program to w, which sends stream
+	// packets. mode 0 disables the redirection, 1 copies the output and 2
+	// redirects it.
+	RedirectStream(ctx context.Context, stream string, mode int, w io.Writer) error
+}
+
+// SourceProvider returns source files for the source command. Without it,
+// Conn reads the files itself, assuming the engine runs on the same host.
+type SourceProvider interface {
+	// Return the contents of an engine side file
+	Source(ctx context.Context, fileName string) ([]byte, error)
 }
 
 // Features describes the supported features of the debugger enging
@@ -37,11 +110,45 @@ type Features struct {
 	Language_name  string
 }
 
-// Breakpoint is a breakpoint in code
+// Breakpoint is a breakpoint as reported by breakpoint_get and
+// breakpoint_list. Clients setting breakpoints return ID, State and Hardware,
+// the other fields are filled in by Conn.
 type Breakpoint struct {
-	ID int `xml:"breakpoint_id,attr"`
+	ID   int    `xml:"id,attr"`
+	Type string `xml:"type,attr"`
 	// Either "enabled" or "disabled"
-	State string `xml:"state,attr"`
+	State     string `xml:"state,attr"`
+	Filename  string `xml:"filename,attr,omitempty"` // IDE side path or file URI
+	Lineno    int    `xml:"lineno,attr,omitempty"`
+	Exception string `xml:"exception,attr,omitempty"`
+	// The program breaks on hits for which HitCount compares to HitValue
+	// as by HitCondition: ">=" (the default), "==", or "%" for every
+	// HitValue'th hit. A HitValue of zero breaks on every hit.
+	HitValue     int    `xml:"hit_value,attr,omitempty"`
+	HitCondition string `xml:"hit_condition,attr,omitempty"`
+	HitCount     int    `xml:"hit_count,attr"`
+	Expression   string `xml:"expression,omitempty"` // of watch breakpoints
+	// x_log breakpoints only: the message logged instead of breaking, see
+	// SplitLogMessage
+	LogMessage string `xml:"x_log_message,omitempty"`
+	// Watch breakpoints only: whether the debugger watches with hardware
+	// support, rather than by single stepping the program, which is slow
+	Hardware bool `xml:"-"`
+}
+
+// HitConditionMet reports whether the program is to break at the
+// HitCount'th hit of the breakpoint
+func (b *Breakpoint) HitConditionMet() bool {
+	if b.HitValue == 0 {
+		return true
+	}
+	switch b.HitCondition {
+	case "==":
+		return b.HitCount == b.HitValue
+	case "%":
+		return b.HitCount%b.HitValue == 0
+	}
+	return b.HitCount >= b.HitValue
 }
 
 type InitResponse struct {
@@ -51,36 +158,215 @@ type InitResponse struct {
 	Thread   string `xml:"thread,attr"`
 	Parent   string `xml:"parent,attr"`
 	Language string `xml:"language,attr"`
-	FileURI  string `xml:"fileuri,attr"`
+	FileURI  string `xml:"fileuri,attr"` // engine side path or file URI, translated for the IDE by Conn
 }
 
 type Stack struct {
-	Level    int    `xml:"level,attr"`    // the stack depth of this stack element
-	Type     string `xml:"type,attr"`     // the type of stack frame. Valid values are "file" or "eval"
-	Filename string `xml:"filename,attr"` // absolute file URI in the local filesystem
-	Lineno   int    `xml:"lineno,attr"`   // 1-based line offset into the buffer
-	Where    string `xml:"where,attr"`    // current command name (optional)
-	cmdBegin string `xml:"cmdbegin,attr"` // (line number):(text offset) from beginning of line for the current instruction (optional)
-	cmdEnd   string `xml:"cmdend,attr"`   // same as CmdBegin, denotes end of current instruction
+	Level    int    `xml:"level,attr"`              // the stack depth of this stack element
+	Type     string `xml:"type,attr"`               // the type of stack frame. Valid values are "file" or "eval"
+	Filename string `xml:"filename,attr"`           // absolute engine side path, translated into a file URI for the IDE by Conn
+	Lineno   int    `xml:"lineno,attr"`             // 1-based line offset into the buffer
+	Where    string `xml:"where,attr"`              // current command name (optional)
+	CmdBegin string `xml:"cmdbegin,attr,omitempty"` // (line number):(text offset) from beginning of line for the current instruction (optional)
+	CmdEnd   string `xml:"cmdend,attr,omitempty"`   // same as CmdBegin, denotes end of current instruction
 }
 
 type Property struct {
-	Name        string `xml:"name,attr"`      // Short variable name.
-	Fullname    string `xml:"fullname,attr"`  // Long variable name. This is the long form of the name which can be eval'd by the language to retrieve the value of the variable.
-	Classname   string `xml:"classname,attr"` // If the type is an object or resource, then the debugger engine MAY specify the class name This is an optional attribute.
-	Type        string `xml:"type,attr"`      // language specific data type name
-	page        string // if not all the children in the first level are returned, then the page attribute, in combination with the pagesize attribute will define where in the array or object these children should be located. The page number is 0-based.
-	pageSize    string // the size of each page of data, defaulted by the debugger engine, or negotiated with feature_set and max_children. Required when the page attribute is available.
-	facet       string // provides a hint to the IDE about additional facets of this value. These are space separated names, such as private, protected, public, constant, etc.
-	size        string // size of property data in bytes
-	children    bool   // true/false whether the property has children this would be true for objects or array's.
-	numChildren int    // optional attribute with number of children for the property.
-	key         string // language dependent reference for the property. if the key is available, the IDE SHOULD use it to retrieve further data for the property, optional
-	Address     string `xml:"address,attr"` // containing physical memory address, optional
-	encoding    string // if this is binary data, it should be base64 encoded with this attribute set
+	XMLName     xml.Name   `xml:"property"`
+	Name        string     `xml:"name,attr"`                  // Short variable name.
+	Fullname    string     `xml:"fullname,attr"`              // Long variable name. This is the long form of the name which can be eval'd by the language to retrieve the value of the variable.
+	Classname   string     `xml:"classname,attr,omitempty"`   // If the type is an object or resource, then the debugger engine MAY specify the class name This is an optional attribute.
+	Type        string     `xml:"type,attr"`                  // language specific data type name
+	Page        int        `xml:"page,attr,omitempty"`        // if not all the children in the first level are returned, then the page attribute, in combination with the pagesize attribute will define where in the array or object these children should be located. The page number is 0-based.
+	PageSize    int        `xml:"pagesize,attr,omitempty"`    // the size of each page of data, defaulted by the debugger engine, or negotiated with feature_set and max_children. Required when the page attribute is available.
+	Facet       string     `xml:"facet,attr,omitempty"`       // provides a hint to the IDE about additional facets of this value. These are space separated names, such as private, protected, public, constant, etc.
+	Size        int        `xml:"size,attr,omitempty"`        // size of property data in bytes
+	HasChildren Bool       `xml:"children,attr"`              // true/false whether the property has children this would be true for objects or array's.
+	NumChildren int        `xml:"numchildren,attr,omitempty"` // optional attribute with number of children for the property.
+	Key         string     `xml:"key,attr,omitempty"`         // language dependent reference for the property. if the key is available, the IDE SHOULD use it to retrieve further data for the property, optional
+	Address     string     `xml:"address,attr"`               // containing physical memory address, optional
+	Encoding    string     `xml:"encoding,attr,omitempty"`    // if this is binary data, it should be base64 encoded with this attribute set
+	Value       string     `xml:",chardata"`                  // the value of the property, if it has no children
+	Children    []Property `xml:"property"`                   // nested properties, e.g. struct fields or array elements
+}
+
+// Bool is a boolean that is encoded as "0" or "1" in DBGP attributes
+type Bool bool
+
+// MarshalXMLAttr implements xml.MarshalerAttr
+func (b Bool) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	if b {
+		return xml.Attr{Name: name, Value: "1"}, nil
+	}
+	return xml.Attr{Name: name, Value: "0"}, nil
+}
+
+// UnmarshalXMLAttr implements xml.UnmarshalerAttr
+func (b *Bool) UnmarshalXMLAttr(attr xml.Attr) error {
+	*b = attr.Value == "1" || attr.Value == "true"
+	return nil
+}
+
+// ThreadLister is optionally implemented by clients that can debug multiple
+// threads of execution. Conn exposes it via the x_thread_list and
+// x_thread_select commands.
+type ThreadLister interface {
+	// Return the threads of the debugged program
+	Threads(ctx context.Context) ([]Thread, error)
+	// Select the thread subsequent stack and context requests operate on
+	SelectThread(ctx context.Context, id int) error
+}
+
+// ExceptionBreakpointSetter is optionally implemented by clients that can
+// break on exceptions, or signals for native programs. Conn uses it for
+// breakpoint_set -t exception -x name.
+type ExceptionBreakpointSetter interface {
+	// Set a breakpoint on the named exception, "*" for all
+	ExceptionBreakpointSet(ctx context.Context, name string) (Breakpoint, error)
+}
+
+// HitConditionSetter is optionally implemented by clients whose debugger can
+// skip hits of a breakpoint itself, which is faster than Conn resuming the
+// program until the hit condition is met. Conn evaluates the conditions a
+// client declines, counting the hits of the breakpoints LastStop reports.
+type HitConditionSetter interface {
+	// Break only on the hits of a breakpoint meeting the condition, see
+	// Breakpoint. Return false if the debugger cannot evaluate it.
+	SetHitCondition(ctx context.Context, id, value int, condition string) (bool, error)
+}
+
+// WatchpointSetter is optionally implemented by clients that can break when
+// the program accesses a variable or memory. Conn uses it for breakpoint_set
+// -t watch -- expression, which breaks on writes, and the x_read_watch and
+// x_access_watch types breaking on reads and on any access.
+type WatchpointSetter interface {
+	// Set a watch breakpoint of the given type on an expression in the
+	// language of the program. Breakpoints on local variables are deleted
+	// when they go out of scope, which Notifier clients should report.
+	WatchpointSet(ctx context.Context, bpType, expression string) (Breakpoint, error)
+}
+
+// LogpointSetter is optionally implemented by clients that can log a message
+// when the program reaches a line, without stopping it. Conn uses it for
+// breakpoint_set -t x_log -f file -n line -- message, and otherwise sets a
+// line breakpoint and logs the message itself, resuming the program after.
+type LogpointSetter interface {
+	// Set a logpoint logging message, with its expressions replaced by
+	// their values. The logged messages are reported as x_log
+	// notifications by Notifier. ErrUnimplemented leaves logging message
+	// to Conn.
+	LogpointSet(ctx context.Context, fileName string, lineNumber int, message string) (Breakpoint, error)
+}
+
+// Notifier is optionally implemented by clients with notifications for the
+// IDE, such as breakpoints deleted by the engine. Conn collects them after
+// every command and sends them as notify packets ahead of the response, once
+// the IDE enabled notifications with feature_set -n notify_ok -v 1.
+type Notifier interface {
+	// Return and forget the pending notifications
+	Notifications() []Notification
+}
+
+// Notification is sent to the IDE as notify packet, e.g. x_breakpoint_deleted
+// when a watch breakpoint went out of scope
+type Notification struct {
+	Name         string
+	BreakpointID int // of the breakpoint concerned, if any
+	Text         string
+}
+
+// MemoryReader is optionally implemented by clients that can read the memory
+// of the debugged program. Conn exposes it via the x_memory_read command.
+type MemoryReader interface {
+	// Read size bytes of memory starting at address
+	ReadMemory(ctx context.Context, address uint64, size int) ([]byte, error)
+}
+
+// Disassembler is optionally implemented by clients that can debug at the
+// instruction level. Conn exposes it via the x_disasm,
+// x_step_into_instruction and x_step_over_instruction commands and serves
+// the disassembly of functions as source of DisasmURIPrefix URIs, which
+// clients use as filename of stack frames without line information.
+type Disassembler interface {
+	// Return the instructions of a function, of the current one if empty
+	Disassemble(ctx context.Context, function string) ([]Instruction, error)
+	// Execute one instruction, stepping into calls. Status and reason as
+	// for StepInto
+	StepIntoInstruction(ctx context.Context) (status string, reason string, err error)
+	// Execute one instruction, stepping over calls. Status and reason as
+	// for StepOver
+	StepOverInstruction(ctx context.Context) (status string, reason string, err error)
+}
+
+// ReverseExecutor is optionally implemented by clients that can execute the
+// program backwards, e.g. by replaying a recording of it. Conn exposes it via
+// the x_step_into_back, x_step_over_back, x_step_out_back and x_run_back
+// commands. Status and reason are as for the forward commands; reaching the
+// beginning of the recorded history stops the program with reason ok.
+type ReverseExecutor interface {
+	// Step backwards into the previous statement, entering calls
+	StepIntoBack(ctx context.Context) (status string, reason string, err error)
+	// Step backwards to the previous statement of the current function
+	StepOverBack(ctx context.Context) (status string, reason string, err error)
+	// Run backwards to the call of the current function
+	StepOutBack(ctx context.Context) (status string, reason string, err error)
+	// Run backwards until a breakpoint or the beginning of the history
+	RunBack(ctx context.Context) (status string, reason string, err error)
+}
+
+// DisasmURIPrefix is the prefix of the pseudo source files holding the
+// disassembly of a function, e.g. dbgp://disasm/main. Line n of the source
+// is the n-th instruction returned by Disassemble.
+const DisasmURIPrefix = "dbgp://disasm/"
+
+// Instruction is a machine instruction of the debugged program
+type Instruction struct {
+	XMLName xml.Name `xml:"instruction"`
+	Address string   `xml:"address,attr"`          // hex address, e.g. 0x401126
+	Symbol  string   `xml:"symbol,attr,omitempty"` // symbol and offset, e.g. main+4
+	Current Bool     `xml:"current,attr"`          // whether this is the next instruction to execute
+	Text    string   `xml:",chardata"`             // the instruction in the debugger's syntax
+}
+
+// String formats the instruction as a line of a disassembly source
+func (i Instruction) String() string {
+	if i.Symbol == "" {
+		return fmt.Sprintf("%s:\t%s", i.Address, i.Text)
+	}
+	return fmt.Sprintf("%s <%s>:\t%s", i.Address, i.Symbol, i.Text)
+}
+
+// Thread is a thread of execution in the debugged program, such as a goroutine
+type Thread struct {
+	XMLName xml.Name `xml:"thread"`
+	ID      int      `xml:"id,attr"`
+	Name    string   `xml:"name,attr"`
+	Current Bool     `xml:"current,attr"`
 }
 
 type Context struct {
-	Name string `xml:"name,attr"`
-	ID   int    `xml:"id,attr"`
+	XMLName xml.Name `xml:"context"`
+	Name    string   `xml:"name,attr"`
+	ID      int      `xml:"id,attr"`
+}
+
+// StopReporter is optionally implemented by clients that can explain why the
+// program stopped. Conn sends the message along the responses of
+// continuation commands as an xdebug:message element, like Xdebug does.
+type StopReporter interface {
+	// Describe the stop after the last continuation command, nil if there
+	// is nothing to report
+	LastStop() *Message
+}
+
+// Message describes a stop of the program
+type Message struct {
+	Filename     string `xml:"filename,attr,omitempty"` // engine side path, translated for the IDE by Conn
+	Lineno       int    `xml:"lineno,attr,omitempty"`
+	Exception    string `xml:"exception,attr,omitempty"`       // name of the signal or exception, if any
+	BreakpointID int    `xml:"x_breakpoint_id,attr,omitempty"` // the breakpoint the program stopped at, needed for hit conditions
+	ExitCode     *int   `xml:"exit_code,attr"`                 // set when the program exited
+	OldValue     string `xml:"x_old_value,attr,omitempty"`     // of the expression of a watch breakpoint, before a write
+	Value        string `xml:"x_value,attr,omitempty"`         // of the expression of a watch breakpoint
+	Text         string `xml:",chardata"`
 }
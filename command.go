@@ -0,0 +1,159 @@
+package dbgp
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxCommandSize is the longest command a Conn accepts unless
+// configured otherwise
+const DefaultMaxCommandSize = 1 << 20
+
+// Request is a command of the IDE
+type Request struct {
+	Command       string
+	TransactionID string            // -i, empty unless it is a valid integer
+	Options       map[string]string // the other options given, by letter, e.g. "d" for -d
+	Data          string            // after --
+
+	ctx context.Context
+}
+
+// Context returns the context of the command, which is cancelled when the
+// command times out or the Conn stops running
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// Option returns an option, empty if not given
+func (r *Request) Option(name string) string {
+	return r.Options[name]
+}
+
+// IntOption returns an integer option, def if not given and ErrInvalidOpts
+// if it is not an integer
+func (r *Request) IntOption(name string, def int) (int, error) {
+	v, ok := r.Options[name]
+	if !ok {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, ErrInvalidOpts
+	}
+	return i, nil
+}
+
+// options of the spec besides -i
+const optionLetters = "abcdefhlmnoprstvx"
+
+// parseCommand parses a command line. The returned request holds the command
+// and the transaction id whenever a valid one was given, even if the command
+// is otherwise invalid.
+func parseCommand(line string) (*Request, error) {
+	r := &Request{Options: make(map[string]string)}
+	parts, err := splitCommand(line)
+	if len(parts) == 0 {
+		return r, ErrParseError
+	}
+	r.Command = parts[0]
+	// look for the transaction id first, to answer invalid commands with it
+	var txID string
+	for i := 1; i < len(parts)-1; i++ {
+		if parts[i] == "--" {
+			break
+		}
+		if _, err := strconv.Atoi(parts[i+1]); parts[i] == "-i" && err == nil {
+			txID = parts[i+1]
+		}
+	}
+	if err != nil {
+		r.TransactionID = txID
+		return r, err
+	}
+
+	flgs := flag.NewFlagSet(r.Command, flag.ContinueOnError)
+	flgs.SetOutput(ioutil.Discard)
+	flgs.StringVar(&r.TransactionID, "i", "", "")
+	for _, o := range optionLetters {
+		flgs.String(string(o), "", "")
+	}
+	if err := flgs.Parse(parts[1:]); err != nil {
+		r.TransactionID = txID
+		return r, ErrInvalidOpts
+	}
+	flgs.Visit(func(f *flag.Flag) {
+		if f.Name != "i" {
+			r.Options[f.Name] = f.Value.String()
+		}
+	})
+	if flgs.NArg() > 0 {
+		r.Data = flgs.Arg(0)
+	}
+	if _, err := strconv.Atoi(r.TransactionID); err != nil {
+		r.TransactionID = ""
+		return r, ErrInvalidOpts
+	}
+	if flgs.NArg() > 1 || (flgs.NArg() == 1 && parts[len(parts)-2] != "--") {
+		// stray arguments
+		return r, ErrInvalidOpts
+	}
+	return r, nil
+}
+
+// splitCommand splits a command line at spaces. Arguments may be double
+// quoted, escaping quotes and backslashes with a backslash. Everything after
+// "--" is kept as a single argument.
+func splitCommand(line string) ([]string, error) {
+	var (
+		parts   []string
+		cur     []byte
+		quoted  bool // cur was quoted, so it is an argument even when empty
+		inQuote bool
+	)
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case inQuote && ch == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\'):
+			i++
+			cur = append(cur, line[i])
+		case inQuote && ch == '"':
+			inQuote = false
+		case inQuote:
+			cur = append(cur, ch)
+		case ch == '"':
+			inQuote, quoted = true, true
+		case ch == ' ':
+			if !quoted && string(cur) == "--" {
+				return append(parts, "--", line[i+1:]), nil
+			}
+			if len(cur) > 0 || quoted {
+				parts = append(parts, string(cur))
+			}
+			cur, quoted = nil, false
+		default:
+			cur = append(cur, ch)
+		}
+	}
+	if inQuote {
+		return parts, ErrParseError
+	}
+	if len(cur) > 0 || quoted {
+		parts = append(parts, string(cur))
+	}
+	return parts, nil
+}
+
+// quoteArg quotes a command argument for splitCommand when needed
+func quoteArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \"\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
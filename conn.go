@@ -1,166 +1,384 @@
 package dbgp
 
 import (
-	"bufio"
-	"encoding/base64"
+	"context"
 	"encoding/xml"
-	"flag"
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/traviscline/dbgp/wire"
 	"io"
-	"io/ioutil"
-	"os"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Conn is a upstream connection to a DBGP-capable IDE or proxy
 type Conn struct {
-	sock   *bufio.ReadWriter
-	client DBGPClient
+	f           *wire.Framer
+	client      DBGPClient
+	challenge   string       // sent with the init packet when authenticating
+	info        InitResponse // of the client, as sent to the IDE
+	handlers    map[string]CommandHandler
+	middleware  []Middleware
+	notify      bool                // notify packets enabled by the IDE with notify_ok
+	breakpoints map[int]*Breakpoint // set by the IDE
+	nativeHits  map[int]bool        // breakpoints whose hit condition the client evaluates
+	nativeLogs  map[int]bool        // logpoints the client logs
+	wmu         sync.Mutex          // serializes packets, streams are written concurrently
+
+	// Paths translates filenames between the IDE and the engine. Every
+	// outgoing filename and incoming -f argument passes through it.
+	Paths PathMap
+
+	// Secret, if set, has to be proven by the IDE with x_auth before any
+	// other command is processed, see AuthResponse
+	Secret string
+
+	// MaxMemoryRead limits the size of x_memory_read requests,
+	// DefaultMaxMemoryRead if zero
+	MaxMemoryRead int
+
+	// Timeout bounds commands other than continuations such as run and
+	// step_into, which last as long as the program runs. No timeout if zero.
+	Timeout time.Duration
+
+	// MaxCommandSize limits the length of commands, DefaultMaxCommandSize if
+	// zero. Longer commands are answered with a parse error.
+	MaxCommandSize int
 }
 
 var protocolVersion = 18
 
+// DefaultMaxMemoryRead is the largest x_memory_read a Conn serves unless
+// configured otherwise
+const DefaultMaxMemoryRead = 1 << 16
+
+// namespace of the xdebug: extension elements
+const xdebugNamespace = "https://xdebug.org/dbgp/xdebug"
+
+// CommandHandler answers a command of the IDE. Errors other than the
+// protocol errors of this package are answered with error code 999.
+type CommandHandler func(c *Conn, r *Request) (*Response, error)
+
+// Middleware wraps the command handlers of a Conn, e.g. for logging, metrics
+// or access control
+type Middleware func(next CommandHandler) CommandHandler
+
+// Response is the answer of a CommandHandler. Attrs are added to the response
+// element and Payload is marshaled as its content, or written as is if Raw.
+type Response struct {
+	Attrs   map[string]interface{}
+	Payload interface{}
+	Raw     bool
+}
+
 // NewConn creates a new DBGP client connection with an rw for the communication
-// and a DBGPClient
+// and a DBGPClient. The built-in commands supported by the client are
+// registered as handlers.
 func NewConn(conn io.ReadWriter, client DBGPClient) *Conn {
-	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
-	return &Conn{rw, client}
+	return &Conn{
+		f:           wire.NewFramer(conn),
+		client:      client,
+		handlers:    defaultHandlers(client),
+		breakpoints: make(map[int]*Breakpoint),
+		nativeHits:  make(map[int]bool),
+		nativeLogs:  make(map[int]bool),
+	}
 }
 
-// Initializes connection with the server
-func (c *Conn) init() error {
-	return c.writeXML(xmlInitMessage{xml.Name{}, c.client.Init(), "1.0"})
+// Handle registers the handler of a command, replacing any previous one
+// including built-in handlers. A nil handler removes the command. Commands
+// must be registered before Run.
+func (c *Conn) Handle(name string, h CommandHandler) {
+	if h == nil {
+		delete(c.handlers, name)
+		return
+	}
+	c.handlers[name] = h
+}
+
+// Handler returns the handler of a command, nil if there is none. Overriding
+// handlers may use it to delegate to the built-in one.
+func (c *Conn) Handler(name string) CommandHandler {
+	return c.handlers[name]
+}
+
+// Use adds middleware wrapping the handling of every command, including
+// unknown ones. The middleware added first is the outermost.
+func (c *Conn) Use(m ...Middleware) {
+	c.middleware = append(c.middleware, m...)
 }
 
-func (c *Conn) next() ([]string, error) {
-	raw, err := c.sock.ReadString(0)
+// Initializes connection with the server
+func (c *Conn) init(ctx context.Context) error {
+	init, err := c.client.Init(ctx)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	init.FileURI = c.Paths.ToIDE(init.FileURI)
+	c.info = init
+	if c.Secret != "" {
+		var err error
+		if c.challenge, err = newChallenge(); err != nil {
+			return err
+		}
 	}
-	return strings.Split(strings.TrimSuffix(raw, "\x00"), " "), nil
+	return c.writeXML(xmlInitMessage{xml.Name{}, wire.Namespace, init, "1.0", c.challenge})
 }
 
-// Run start the upstream communication and invokes teh client
+// Run start the upstream communication and invokes teh client. It returns
+// when the IDE closes the connection or on write errors; malformed commands
+// are answered with error responses.
 func (c *Conn) Run() error {
-	if err := c.init(); err != nil {
+	return c.RunContext(context.Background())
+}
+
+// RunContext is like Run, passing ctx on to the client. Cancelling ctx
+// cancels the command in progress and stops RunContext once it is answered;
+// while waiting for a command it stops when the connection is closed. A break
+// received while a continuation runs cancels the continuation.
+func (c *Conn) RunContext(ctx context.Context) error {
+	if err := c.init(ctx); err != nil {
 		return err
 	}
-	flgs := new(flag.FlagSet)
-	// @todo move to -1 as "unset"
-	txID := flgs.Int("i", 0, "")
-	depth := flgs.Int("d", 0, "")
-	fileName := flgs.String("f", "", "")
-	context := flgs.Int("c", 0, "")
-	varN := flgs.String("n", "", "")
-	bpType := flgs.String("t", "", "")
-	_ = flgs.String("s", "", "")
-	_ = flgs.String("v", "", "")
-	_ = flgs.Int("r", 0, "")
+	c.f.MaxSize = c.MaxCommandSize
+	if c.f.MaxSize == 0 {
+		c.f.MaxSize = DefaultMaxCommandSize
+	}
 
-	for {
-		// reinit flags
-		flgs.Init("", flag.ContinueOnError)
+	quit := make(chan struct{})
+	defer close(quit)
+	cmds := c.readCommands(quit)
+	var queued []commandLine // read while a continuation ran
 
-		parts, err := c.next()
+	authenticated := c.Secret == ""
+	for {
+		var next commandLine
+		if len(queued) > 0 {
+			next, queued = queued[0], queued[1:]
+		} else {
+			next = <-cmds
+		}
+		line, err := next.line, next.err
+		if err == wire.ErrTooLarge {
+			glog.Warningln("command exceeds", c.f.MaxSize, "bytes")
+			if err := c.writeError("", "", ErrParseError); err != nil {
+				return err
+			}
+			continue
+		}
 		if err != nil {
 			if err == io.EOF {
 				return nil
 			}
 			return err
 		}
+		glog.V(2).Infoln(line)
 
-		glog.V(2).Infoln(parts, err)
-		if err != nil {
-			c.writeError("unknown", *txID, err)
-		}
-
-		cmd := parts[0]
-		flgs.Parse(parts[1:])
-
-		attrs := make(map[string]interface{})
-		var (
-			payload    interface{}
-			payloadRaw bool // controls whether payload shoudl be marshalled or if it's already prepared
-		)
-		switch cmd {
-		case "status":
-			attrs["status"] = c.client.Status()
-		case "step_into":
-			status, reason := c.client.StepInto()
-			attrs["status"] = status
-			attrs["reason"] = reason
-		case "step_over":
-			status, reason := c.client.StepOver()
-			attrs["status"] = status
-			attrs["reason"] = reason
-		case "stack_depth":
-			attrs["depth"] = c.client.StackDepth()
-		case "source":
-			fn := strings.Replace(*fileName, "file://", "", 1)
-			f, err := os.Open(fn)
-			if err != nil {
-				glog.V(2).Infoln("error opening file:", fn, err)
-				break
+		r, err := parseCommand(line)
+		if !authenticated {
+			if err == nil {
+				err = c.authenticate(r)
 			}
-			a, err := ioutil.ReadAll(f)
 			if err != nil {
-				glog.V(2).Infoln("error reading file:", err)
-				break
-			}
-			attrs["encoding"] = "base64"
-			payload = "<![CDATA[" + base64.StdEncoding.EncodeToString(a) + "]]>"
-			payloadRaw = true
-		case "stack_get":
-			stackEntries, sgerr := c.client.StackGet(*depth)
-			if sgerr != nil {
-				err = sgerr
-				break
+				glog.Warningln("authentication failed:", err)
+				c.writeError(r.Command, r.TransactionID, err)
+				return ErrAuthentication
 			}
-			wrapped := make([]stack, len(stackEntries))
-			for i, se := range stackEntries {
-				wrapped[i] = stack{se}
+			authenticated = true
+			if err := c.writeResponse(r.Command, r.TransactionID, map[string]interface{}{"success": 1}, nil, false); err != nil {
+				return err
 			}
-			payload = wrapped
-
-		case "context_names":
-			payload, err = c.client.ContextNames(*depth)
-
-		case "context_get":
-			payload, err = c.client.ContextGet(*depth, *context)
-
-		case "property_get":
-			payload, err = c.client.PropertyGet(*depth, *context, *varN)
-		case "feature_get":
-			fieldName := strings.Title(*varN)
-			v, _ := getFieldValueByName(c.client.Features(), fieldName)
-			payload = v
-		case "breakpoint_set":
-			lineNumber, bperr := strconv.Atoi(*varN)
-			if bperr != nil {
-				err = bperr
-				break
+			continue
+		}
+		resp := new(Response)
+		if err == nil {
+			var cancel context.CancelFunc
+			r.ctx, cancel = c.commandContext(ctx, r.Command)
+			if continuations[r.Command] {
+				var more []commandLine
+				resp, more, err = c.handleContinuation(ctx, r, cancel, cmds)
+				queued = append(queued, more...)
+			} else {
+				resp, err = c.handle(r)
 			}
-			var bp Breakpoint
-			bp, err = c.client.BreakpointSet(*bpType, *fileName, lineNumber)
-			attrs["breakpoint_id"] = bp.ID
-			attrs["state"] = bp.State
-		default:
-			err = ErrUnimplemented
+			cancel()
+		}
+		if err := c.writeNotifications(); err != nil {
+			return err
 		}
 		if err != nil {
-			err = c.writeError(cmd, *txID, err)
+			err = c.writeError(r.Command, r.TransactionID, err)
 		} else {
-			err = c.writeResponse(cmd, *txID, attrs, payload, payloadRaw)
+			err = c.writeResponse(r.Command, r.TransactionID, resp.Attrs, resp.Payload, resp.Raw)
 		}
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 	}
 }
 
-func (c *Conn) writeError(cmd string, txID int, err error) error {
+// commandLine is a command read from the IDE, or the error reading it
+type commandLine struct {
+	line string
+	err  error
+}
+
+// readCommands reads the commands of the IDE in the background, so break can
+// be read while a continuation runs. It stops after a read error or once quit
+// is closed.
+func (c *Conn) readCommands(quit <-chan struct{}) <-chan commandLine {
+	ch := make(chan commandLine)
+	go func() {
+		for {
+			line, err := c.f.ReadCommand()
+			select {
+			case ch <- commandLine{line, err}:
+			case <-quit:
+				return
+			}
+			if err != nil && err != wire.ErrTooLarge {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// handleContinuation handles a command resuming the program while reading
+// further commands. break cancels the command, interrupting the program, and
+// is answered right away; the continuation is then answered with the status
+// of the client and reason aborted. Other commands are returned to be handled
+// once the continuation is answered.
+func (c *Conn) handleContinuation(ctx context.Context, r *Request, cancel context.CancelFunc, cmds <-chan commandLine) (*Response, []commandLine, error) {
+	type result struct {
+		resp *Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := c.handle(r)
+		done <- result{resp, err}
+	}()
+	var queued []commandLine
+	interrupted := false
+	for {
+		select {
+		case res := <-done:
+			if interrupted && res.err != nil && ctx.Err() == nil {
+				status, err := c.client.Status(ctx)
+				if err != nil {
+					return nil, queued, err
+				}
+				return &Response{Attrs: map[string]interface{}{"status": status, "reason": "aborted"}}, queued, nil
+			}
+			return res.resp, queued, res.err
+		case next := <-cmds:
+			queued = append(queued, next)
+			if next.err != nil {
+				if next.err != wire.ErrTooLarge {
+					// the IDE is gone
+					cancel()
+				}
+				continue
+			}
+			br, err := parseCommand(next.line)
+			if err != nil || br.Command != "break" {
+				continue
+			}
+			queued = queued[:len(queued)-1]
+			glog.V(1).Infoln("break while handling", r.Command)
+			interrupted = true
+			cancel()
+			if err := c.writeResponse(br.Command, br.TransactionID, map[string]interface{}{"success": 1}, nil, false); err != nil {
+				glog.Warningln("answering break:", err)
+			}
+		}
+	}
+}
+
+// continuations are the commands resuming the program, which are not bound
+// by Timeout
+var continuations = map[string]bool{
+	"run": true, "step_into": true, "step_over": true,
+	"x_step_into_instruction": true, "x_step_over_instruction": true,
+	"x_step_into_back": true, "x_step_over_back": true, "x_step_out_back": true, "x_run_back": true,
+}
+
+// commandContext returns the context of a command
+func (c *Conn) commandContext(ctx context.Context, cmd string) (context.Context, context.CancelFunc) {
+	if c.Timeout > 0 && !continuations[cmd] {
+		return context.WithTimeout(ctx, c.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// handle invokes the handler of a command through the middleware. Panics are
+// turned into errors, so a single command cannot bring down the connection.
+func (c *Conn) handle(r *Request) (resp *Response, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			glog.Errorln("panic handling", r.Command+":", p)
+			resp, err = nil, dbgpError{999, fmt.Sprint("internal error: ", p)}
+		}
+	}()
+
+	h, ok := c.handlers[r.Command]
+	if !ok {
+		h = handleUnimplemented
+	}
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		h = c.middleware[i](h)
+	}
+	resp, err = h(c, r)
+	if resp == nil && err == nil {
+		resp = new(Response)
+	}
+	return resp, err
+}
+
+// writeNotifications sends the pending notifications of the client, or drops
+// them unless the IDE enabled notifications
+func (c *Conn) writeNotifications() error {
+	n, ok := c.client.(Notifier)
+	if !ok {
+		return nil
+	}
+	for _, note := range n.Notifications() {
+		if note.Name == "x_breakpoint_deleted" {
+			// whether or not the IDE hears of it
+			c.forgetBreakpoint(note.BreakpointID)
+		}
+		if err := c.writeNotification(note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNotification sends a notify packet unless the IDE did not enable
+// notifications. Logged messages are then sent as stdout stream instead.
+func (c *Conn) writeNotification(note Notification) error {
+	if !c.notify {
+		if note.Name == "x_log" {
+			_, err := streamWriter{c, "stdout"}.Write([]byte(note.Text + "\n"))
+			return err
+		}
+		glog.V(1).Infoln("dropping notification", note.Name, note.Text)
+		return nil
+	}
+	msg := xmlNotify{Xmlns: wire.Namespace, Name: note.Name, Text: note.Text}
+	if note.BreakpointID != 0 {
+		msg.Breakpoint = &xmlNotifyBreakpoint{ID: note.BreakpointID}
+	}
+	return c.writeXML(msg)
+}
+
+func (c *Conn) writeError(cmd, txID string, err error) error {
 	if _, ok := err.(dbgpError); !ok {
 		err = dbgpError{999, err.Error()}
 	}
@@ -173,19 +391,21 @@ func (c *Conn) writeError(cmd string, txID int, err error) error {
 	return c.writeResponse(cmd, txID, nil, e, false)
 }
 
-func (c *Conn) writeResponse(cmd string, txID int, attrs map[string]interface{}, payload interface{}, payloadRaw bool) error {
+func (c *Conn) writeResponse(cmd, txID string, attrs map[string]interface{}, payload interface{}, payloadRaw bool) error {
 	if attrs == nil {
 		attrs = make(map[string]interface{})
 	}
 
 	attrs["command"] = cmd
 	attrs["transaction_id"] = txID
-	attrs["xmlns"] = "urn:debugger_protocol_v1"
+	attrs["xmlns"] = wire.Namespace
 
 	attrsToStrings := make([]string, 0, len(attrs))
 	for k, v := range attrs {
-		attrsToStrings = append(attrsToStrings, fmt.Sprint(k, `="`, v, `"`))
+		attrsToStrings = append(attrsToStrings, k+`="`+escapeText(fmt.Sprint(v))+`"`)
 	}
+	// stable order, so sessions can be compared
+	sort.Strings(attrsToStrings)
 
 	var (
 		payloadBytes []byte
@@ -196,55 +416,50 @@ func (c *Conn) writeResponse(cmd string, txID int, attrs map[string]interface{},
 	} else {
 		payloadBytes, err = xml.MarshalIndent(payload, "", " ")
 		if err != nil {
-			return err
+			glog.Warningln("marshaling", cmd, "response:", err)
+			return c.writeError(cmd, txID, err)
 		}
-
 	}
 
 	r := fmt.Sprintf(`<response %s>%s</response>`,
 		strings.Join(attrsToStrings, " "),
 		string(payloadBytes))
 
-	return c.writeBytes([]byte(r))
+	return c.writePacket([]byte(r))
 }
 
-var nul = []byte{0}
-
 func (c *Conn) writeXML(v interface{}) error {
 	b, err := xml.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return err
 	}
-	length := len(b) + len(xml.Header)
-	c.sock.WriteString(fmt.Sprint(length))
-	c.sock.Write(nul)
-	c.sock.WriteString(xml.Header)
-	_, err = c.sock.Write(b)
-	if err != nil {
-		return err
-	}
-	c.sock.Write(nul)
-	return c.sock.Flush()
+	return c.writePacket(append([]byte(xml.Header), b...))
 }
 
-type stack struct {
-	Stack
+func (c *Conn) writePacket(b []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.f.WritePacket(b)
 }
 
-func (c *Conn) writeBytes(b []byte) error {
-	c.sock.WriteString(fmt.Sprint(len(b)))
-	c.sock.Write(nul)
-	_, err := c.sock.Write(b)
-	if err != nil {
-		return err
-	}
-	c.sock.Write(nul)
-	return c.sock.Flush()
+// Encodes a notify packet
+type xmlNotify struct {
+	XMLName    xml.Name             `xml:"notify"`
+	Xmlns      string               `xml:"xmlns,attr"`
+	Name       string               `xml:"name,attr"`
+	Breakpoint *xmlNotifyBreakpoint `xml:"breakpoint"`
+	Text       string               `xml:",chardata"`
+}
+
+type xmlNotifyBreakpoint struct {
+	ID int `xml:"id,attr"`
 }
 
 // Encodes an init message
 type xmlInitMessage struct {
 	XMLName xml.Name `xml:"init"`
+	Xmlns   string   `xml:"xmlns,attr"`
 	InitResponse
 	ProtocolVersion string `xml:"protocol_version,attr"`
+	Challenge       string `xml:"x_challenge,attr,omitempty"`
 }
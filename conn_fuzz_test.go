@@ -0,0 +1,136 @@
+package dbgp_test
+
+import (
+	"bytes"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/dbgptest"
+	"github.com/traviscline/dbgp/wire"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fuzzEngine stops once with a frame and a property
+func fuzzEngine(name, value string) *dbgptest.Engine {
+	return dbgptest.NewEngine(dbgptest.Stop{
+		Stack: []dbgp.Stack{{Type: "file", Filename: "/src/main.c", Lineno: 1, Where: "main"}},
+		Properties: map[dbgptest.Scope][]dbgp.Property{
+			{Depth: 0, Context: 0}: {{Name: name, Fullname: name, Type: "string", Value: value}},
+		},
+	})
+}
+
+// initPacket is a valid init packet, which an IDE never sends
+const initPacket = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+	`<init xmlns="urn:debugger_protocol_v1" appid="1" idekey="key" language="c" protocol_version="1.0" fileuri="file:///src/main.c"></init>`
+
+// FuzzConn sends arbitrary bytes as commands to a dbgp.Conn and checks that
+// every NUL terminated command is answered with exactly one well formed
+// response
+func FuzzConn(f *testing.F) {
+	for _, seed := range []string{
+		"status -i 1\x00",
+		"step_into -i 1\x00stack_get -i 2 -d 0\x00",
+		"step_into -i 1\x00property_get -i 2 -n \"my var\"\x00",
+		"breakpoint_set -i 1 -t line -f file:///src/main.c -n x\x00",
+		"breakpoint_set -t line\x00",
+		"feature_get -i 1 -n language_name\x00",
+		"context_get -i 1 -d -1 -c 99\x00",
+		"property_set -i 1 -n x -- aGk=\x00",
+		"property_set -i 1 -n x -- !!!*\x00", // bad base64 after --
+		"x_thread_select -i 1 -n one\x00",
+		strconv.Itoa(len(initPacket)) + "\x00" + initPacket + "\x00",
+		"12",                         // truncated length prefix
+		"status -i 1\x00status -i 2", // missing NUL
+		"\x00",
+		"\x00\x00",
+		"status -i \"1\x00",
+		"status -i 1 -q 2 stray\x00",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ide, err := dbgptest.NewIDE(fuzzEngine("x", "1"), func(c *dbgp.Conn) { c.MaxCommandSize = 1 << 10 })
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ide.Close()
+
+		written := make(chan error, 1)
+		go func() { written <- ide.Write(data) }()
+		// an unterminated command at the end is never answered
+		for i, n := 0, bytes.Count(data, []byte{0}); i < n; i++ {
+			m, err := ide.ReadMessage()
+			if err != nil {
+				t.Fatalf("response %d of %d: %v", i+1, n, err)
+			}
+			resp, ok := m.(*wire.Response)
+			if !ok {
+				t.Fatalf("response %d of %d is not a response: %q", i+1, n, m.Packet())
+			}
+			if _, ok := resp.Attr("transaction_id"); !ok {
+				t.Errorf("no transaction_id in %q", m.Packet())
+			}
+			if _, ok := resp.Attr("command"); !ok {
+				t.Errorf("no command in %q", m.Packet())
+			}
+		}
+		if err := <-written; err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// FuzzResponse has a dbgp.Conn encode properties with arbitrary names and
+// values, checking that responses are well formed and names survive
+func FuzzResponse(f *testing.F) {
+	f.Add("x", "1")
+	f.Add("a<b", "\"quoted\" & 'apos'")
+	f.Add("my var", "]]>")
+	f.Add("\x00\xff", "\x01￾")
+	f.Fuzz(func(t *testing.T, name, value string) {
+		ide, err := dbgptest.NewIDE(fuzzEngine(name, value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ide.Close()
+
+		if _, err := ide.Command("step_into"); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ide.Command("context_get", "-d", "0", "-c", "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != nil {
+			return
+		}
+		if len(resp.Properties) != 1 {
+			t.Fatalf("got %d properties, want 1: %q", len(resp.Properties), resp.Raw)
+		}
+		if got := resp.Properties[0].Name; isXMLText(name) && got != name {
+			t.Errorf("name %q came back as %q", name, got)
+		}
+	})
+}
+
+// isXMLText reports whether s only consists of characters XML can represent
+func isXMLText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if !isInCharacterRange(r) {
+			return false
+		}
+	}
+	return !strings.ContainsRune(s, '\r')
+}
+
+func isInCharacterRange(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
@@ -0,0 +1,140 @@
+package dbgp_test
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/dbgptest"
+	"github.com/traviscline/dbgp/wire"
+	"net"
+	"testing"
+	"time"
+)
+
+// blockingClient runs until the command is cancelled
+type blockingClient struct{}
+
+func (blockingClient) Init(ctx context.Context) (dbgp.InitResponse, error) {
+	return dbgp.InitResponse{Language: "test"}, nil
+}
+
+func (blockingClient) Status(ctx context.Context) (string, error) {
+	return "break", nil
+}
+
+func (blockingClient) StepInto(ctx context.Context) (string, string, error) {
+	<-ctx.Done()
+	return "break", "ok", ctx.Err()
+}
+
+func (blockingClient) StepOver(ctx context.Context) (string, string, error) {
+	<-ctx.Done()
+	return "break", "ok", ctx.Err()
+}
+
+func (blockingClient) Run(ctx context.Context) (string, string, error) {
+	<-ctx.Done()
+	return "break", "ok", ctx.Err()
+}
+
+func TestBreakDuringContinuation(t *testing.T) {
+	ide, err := dbgptest.NewIDE(blockingClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ide.Close()
+
+	// status is queued behind run, break interrupts it
+	if err := ide.Write([]byte("run -i 1\x00status -i 2\x00")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ide.Send("break -i 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Command != "break" || resp.TransactionID != "3" {
+		t.Fatalf("got %s %s first, want break 3", resp.Command, resp.TransactionID)
+	}
+	if v, _ := resp.Attr("success"); v != "1" {
+		t.Errorf("break success = %q, want 1", v)
+	}
+
+	for _, want := range []struct{ command, txID, reason string }{
+		{"run", "1", "aborted"},
+		{"status", "2", "ok"},
+	} {
+		m, err := ide.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, ok := m.(*wire.Response)
+		if !ok {
+			t.Fatalf("got %q, want a response", m.Packet())
+		}
+		var resp dbgptest.Response
+		if err := xml.Unmarshal(r.Packet(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != nil {
+			t.Fatalf("%s: error %v", want.command, resp.Error)
+		}
+		if resp.Command != want.command || resp.TransactionID != want.txID {
+			t.Fatalf("got %s %s, want %s %s", resp.Command, resp.TransactionID, want.command, want.txID)
+		}
+		if resp.Status != "break" || resp.Reason != want.reason {
+			t.Errorf("%s: got status %q reason %q, want break %q", want.command, resp.Status, resp.Reason, want.reason)
+		}
+	}
+}
+
+func TestBreakWhileIdle(t *testing.T) {
+	ide, err := dbgptest.NewIDE(blockingClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ide.Close()
+
+	resp, err := ide.Command("break")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if v, _ := resp.Attr("success"); v != "0" {
+		t.Errorf("break success = %q, want 0", v)
+	}
+}
+
+// TestRemoteCancel cancels a Remote continuation, which interrupts the engine
+func TestRemoteCancel(t *testing.T) {
+	ideSide, engineSide := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- dbgp.NewConn(engineSide, blockingClient{}).Run()
+		engineSide.Close()
+	}()
+	defer func() {
+		ideSide.Close()
+		if err := <-done; err != nil {
+			t.Error("engine conn:", err)
+		}
+	}()
+	r, err := dbgp.NewRemote(ideSide)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := r.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Run returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	status, err := r.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "break" {
+		t.Errorf("status %q after cancelling, want break", status)
+	}
+}
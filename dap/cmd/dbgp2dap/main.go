@@ -0,0 +1,112 @@
+// Program dbgp2dap exposes DBGP engines to Debug Adapter Protocol frontends
+// such as VS Code or Neovim. It speaks DAP over stdio.
+//
+// A "launch" request starts the program under one of the local backends:
+//
+//	{"program": "./binary", "args": ["arg1"], "cwd": "/tmp", "env": {"FOO": "bar"}, "stopOnEntry": true}
+//
+// An "attach" request waits for a remote DBGP engine (gdb2dbgp, Xdebug, ...)
+// to connect to the -listen address.
+//
+// note: stdout carries the protocol, debug with: -v=2 -log_dir=/tmp
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/dap"
+	"github.com/traviscline/dbgp/delveproxy"
+	"github.com/traviscline/dbgp/gdbproxy"
+	"github.com/traviscline/dbgp/lldbproxy"
+	"github.com/traviscline/dbgp/transport"
+	"io"
+	"os"
+)
+
+var backend = flag.String("backend", "gdb", "backend used for launch requests: gdb, lldb or dlv")
+var listen = flag.String("listen", "localhost:9000", "address remote DBGP engines connect to for attach requests")
+var tlsConfig = transport.Flags(flag.CommandLine)
+var pathMap dbgp.PathMap
+
+func init() {
+	flag.Var(&pathMap, "map", "path mapping of the form ide_path=engine_path (repeatable)")
+}
+
+type launchArgs struct {
+	Program string            `json:"program"`
+	Args    []string          `json:"args"`
+	Cwd     string            `json:"cwd"`
+	Env     map[string]string `json:"env"`
+}
+
+func launch(request string, raw json.RawMessage) (dbgp.DBGPClient, error) {
+	ideKey, session := os.Getenv("DBGP_IDEKEY"), os.Getenv("DBGP_COOKIE")
+	if request == "attach" {
+		return attach()
+	}
+
+	var args launchArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Program == "" {
+		return nil, fmt.Errorf("no program specified")
+	}
+	var env []string
+	for k, v := range args.Env {
+		env = append(env, k+"="+v)
+	}
+	switch *backend {
+	case "gdb":
+		return gdbproxy.New(args.Program, ideKey, session,
+			gdbproxy.WithArgs(args.Args...), gdbproxy.WithEnv(env...), gdbproxy.WithDir(args.Cwd))
+	case "lldb":
+		return lldbproxy.New(args.Program, ideKey, session,
+			lldbproxy.WithArgs(args.Args...), lldbproxy.WithEnv(env...), lldbproxy.WithDir(args.Cwd))
+	case "dlv":
+		return delveproxy.New(args.Program, ideKey, session,
+			delveproxy.WithArgs(args.Args...), delveproxy.WithEnv(env...), delveproxy.WithDir(args.Cwd))
+	}
+	return nil, fmt.Errorf("unknown backend %q", *backend)
+}
+
+// waits for a remote engine to connect
+func attach() (dbgp.DBGPClient, error) {
+	l, err := transport.Listen(*listen, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	c, err := l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	r, err := dbgp.NewRemote(c)
+	if err != nil {
+		return nil, err
+	}
+	if secret := os.Getenv("DBGP_SECRET"); secret != "" {
+		if err := r.Authenticate(secret); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+type stdio struct {
+	io.Reader
+	io.Writer
+}
+
+func main() {
+	flag.Parse()
+	s := dap.NewServer(stdio{os.Stdin, os.Stdout}, launch)
+	s.Paths = pathMap
+	if err := s.Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error serving DAP:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,31 @@
+package dap
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReadPacket(t *testing.T) {
+	for _, tt := range []struct {
+		name, input string
+		command     string // of the packet read, empty for an error
+	}{
+		{"request", "Content-Length: 43\r\n\r\n" + `{"seq":1,"type":"request","command":"next"}`, "next"},
+		{"no length", "Content-Type: application/json\r\n\r\n{}", ""},
+		{"negative length", "Content-Length: -1\r\n\r\n{}", ""},
+		{"too large", fmt.Sprintf("Content-Length: %d\r\n\r\n{}", MaxSize+1), ""},
+		{"truncated", "Content-Length: 10\r\n\r\n{}", ""},
+	} {
+		p, err := ReadPacket(bufio.NewReader(strings.NewReader(tt.input)))
+		switch {
+		case tt.command == "" && err == nil:
+			t.Errorf("%s: read %+v, want an error", tt.name, p)
+		case tt.command != "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.command != "" && p.Command != tt.command:
+			t.Errorf("%s: read command %q, want %q", tt.name, p.Command, tt.command)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/traviscline/dbgp"
+	"io"
+	"sync"
+)
+
+// LaunchFunc creates the client for a session from a "launch" or "attach"
+// request and its adapter specific arguments
+type LaunchFunc func(request string, args json.RawMessage) (dbgp.DBGPClient, error)
+
+// Server is a DAP server that translates DAP requests into calls on a
+// dbgp.DBGPClient, exposing DBGP engines to DAP frontends such as VS Code
+type Server struct {
+	launch LaunchFunc
+	client dbgp.DBGPClient
+
+	r *bufio.Reader
+	w *bufio.Writer
+
+	mu  sync.Mutex // guards seq and w
+	seq int
+
+	// Paths translates between the client's filenames and the frontend's paths
+	Paths dbgp.PathMap
+
+	ctx         context.Context // of the calls on the client
+	stopOnEntry bool
+	breakpoints map[string]map[int]dbgp.Breakpoint // by path and line
+	refs        map[int]varRef
+	lastRef     int
+}
+
+// varRef is what a DAP variablesReference points at: either a DBGP context or
+// the children of a property
+type varRef struct {
+	depth, context int
+	property       *dbgp.Property
+}
+
+// NewServer creates a server communicating over rw, typically stdio. launch is
+// invoked to create the client when the frontend sends "launch" or "attach".
+func NewServer(rw io.ReadWriter, launch LaunchFunc) *Server {
+	return &Server{
+		launch:      launch,
+		ctx:         context.Background(),
+		r:           bufio.NewReader(rw),
+		w:           bufio.NewWriter(rw),
+		breakpoints: make(map[string]map[int]dbgp.Breakpoint),
+		refs:        make(map[int]varRef),
+	}
+}
+
+// Serve handles requests until the frontend disconnects
+func (s *Server) Serve() error {
+	for {
+		p, err := ReadPacket(s.r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if p.Type != "request" {
+			continue
+		}
+		glog.V(2).Infoln("[dap] <-", p.Command, string(p.Arguments))
+		body, err := s.handle(p)
+		if err := s.respond(p, body, err); err != nil {
+			return err
+		}
+		switch p.Command {
+		case "launch", "attach":
+			if err == nil {
+				s.event("initialized", nil)
+			}
+		case "configurationDone":
+			if step := s.stepper("stepIn"); s.stopOnEntry && step != nil {
+				s.continuation(step, "entry")
+			} else if step := s.stepper("continue"); step != nil {
+				s.continuation(step, "breakpoint")
+			}
+		case "continue":
+			if err == nil {
+				s.continuation(s.stepper(p.Command), "breakpoint")
+			}
+		case "next", "stepIn":
+			if err == nil {
+				s.continuation(s.stepper(p.Command), "step")
+			}
+		case "disconnect":
+			if c, ok := s.client.(io.Closer); ok {
+				c.Close()
+			}
+			return nil
+		}
+	}
+}
+
+// handle computes the response body for a request
+func (s *Server) handle(p *Packet) (interface{}, error) {
+	if s.client == nil {
+		switch p.Command {
+		case "initialize", "launch", "attach", "disconnect":
+		default:
+			return nil, fmt.Errorf("%s before launch", p.Command)
+		}
+	}
+
+	switch p.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		}, nil
+
+	case "launch", "attach":
+		var args struct {
+			StopOnEntry bool `json:"stopOnEntry"`
+		}
+		json.Unmarshal(p.Arguments, &args)
+		s.stopOnEntry = args.StopOnEntry
+		client, err := s.launch(p.Command, p.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := client.Init(s.ctx); err != nil {
+			return nil, err
+		}
+		s.client = client
+		return nil, nil
+
+	case "setBreakpoints":
+		var args struct {
+			Source      Source             `json:"source"`
+			Breakpoints []SourceBreakpoint `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(p.Arguments, &args); err != nil {
+			return nil, err
+		}
+		path, err := s.Paths.ToEngine(args.Source.Path)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"breakpoints": s.setBreakpoints(path, args.Breakpoints)}, nil
+
+	case "configurationDone", "disconnect", "continue", "next", "stepIn":
+		// continuations run after responding
+		if p.Command != "configurationDone" && p.Command != "disconnect" && s.stepper(p.Command) == nil {
+			return nil, fmt.Errorf("%s is not supported by the engine", p.Command)
+		}
+		if p.Command == "continue" {
+			return map[string]interface{}{"allThreadsContinued": true}, nil
+		}
+		return nil, nil
+
+	case "threads":
+		threads := []Thread{{ID: 1, Name: "main"}}
+		if tl, ok := s.client.(dbgp.ThreadLister); ok {
+			if ts, err := tl.Threads(s.ctx); err == nil && len(ts) > 0 {
+				threads = threads[:0]
+				for _, t := range ts {
+					threads = append(threads, Thread{ID: t.ID, Name: t.Name})
+				}
+			}
+		}
+		return map[string]interface{}{"threads": threads}, nil
+
+	case "stackTrace":
+		si, ok := s.client.(dbgp.StackInspector)
+		if !ok {
+			return nil, fmt.Errorf("the engine has no call stack")
+		}
+		stack, err := si.StackGet(s.ctx, 0)
+		if err != nil {
+			return nil, err
+		}
+		frames := make([]StackFrame, len(stack))
+		for i, se := range stack {
+			frames[i] = StackFrame{ID: se.Level, Name: se.Where, Line: se.Lineno, Column: 1}
+			if se.Filename != "" {
+				path, err := dbgp.ParseFileURI(s.Paths.ToIDE(se.Filename))
+				if err != nil {
+					path = se.Filename
+				}
+				frames[i].Source = &Source{Path: path}
+			}
+		}
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if err := json.Unmarshal(p.Arguments, &args); err != nil {
+			return nil, err
+		}
+		e, err := s.evaluator()
+		if err != nil {
+			return nil, err
+		}
+		contexts, err := e.ContextNames(s.ctx, args.FrameID)
+		if err != nil {
+			return nil, err
+		}
+		scopes := make([]Scope, len(contexts))
+		for i, c := range contexts {
+			scopes[i] = Scope{Name: c.Name, VariablesReference: s.ref(varRef{depth: args.FrameID, context: c.ID})}
+		}
+		return map[string]interface{}{"scopes": scopes}, nil
+
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(p.Arguments, &args); err != nil {
+			return nil, err
+		}
+		ref, ok := s.refs[args.VariablesReference]
+		if !ok {
+			return nil, fmt.Errorf("unknown variablesReference %d", args.VariablesReference)
+		}
+		properties, err := s.children(ref)
+		if err != nil {
+			return nil, err
+		}
+		vars := make([]Variable, len(properties))
+		for i := range properties {
+			vars[i] = s.variable(ref.depth, ref.context, &properties[i])
+		}
+		return map[string]interface{}{"variables": vars}, nil
+
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+			FrameID    int    `json:"frameId"`
+		}
+		if err := json.Unmarshal(p.Arguments, &args); err != nil {
+			return nil, err
+		}
+		e, err := s.evaluator()
+		if err != nil {
+			return nil, err
+		}
+		prop, err := e.PropertyGet(s.ctx, args.FrameID, 0, args.Expression)
+		if err != nil {
+			return nil, err
+		}
+		v := s.variable(args.FrameID, 0, &prop)
+		return map[string]interface{}{
+			"result":             v.Value,
+			"type":               v.Type,
+			"variablesReference": v.VariablesReference,
+		}, nil
+	}
+	return nil, fmt.Errorf("%s is not supported", p.Command)
+}
+
+// setBreakpoints sets the breakpoints of a source, given by its engine side
+// path, that are not set yet and removes those no longer requested. Clients
+// that cannot remove breakpoints keep them in place.
+func (s *Server) setBreakpoints(path string, requested []SourceBreakpoint) []Breakpoint {
+	bm, _ := s.client.(dbgp.BreakpointManager)
+	set, ok := s.breakpoints[path]
+	if !ok {
+		set = make(map[int]dbgp.Breakpoint)
+		s.breakpoints[path] = set
+	}
+	if br, ok := s.client.(dbgp.BreakpointRemover); ok {
+		lines := make(map[int]bool, len(requested))
+		for _, sb := range requested {
+			lines[sb.Line] = true
+		}
+		for line, bp := range set {
+			if lines[line] {
+				continue
+			}
+			if err := br.BreakpointRemove(s.ctx, bp.ID); err != nil {
+				glog.Warningln("[dap] removing breakpoint", bp.ID, "failed:", err)
+				continue
+			}
+			delete(set, line)
+		}
+	}
+	result := make([]Breakpoint, len(requested))
+	for i, sb := range requested {
+		result[i] = Breakpoint{Line: sb.Line}
+		bp, ok := set[sb.Line]
+		if !ok {
+			if bm == nil {
+				result[i].Message = "breakpoints are not supported by the engine"
+				continue
+			}
+			var err error
+			bp, err = bm.BreakpointSet(s.ctx, "line", path, sb.Line)
+			if err != nil {
+				result[i].Message = err.Error()
+				continue
+			}
+			set[sb.Line] = bp
+		}
+		result[i].ID = bp.ID
+		result[i].Verified = true
+	}
+	return result
+}
+
+// children returns the properties behind a reference
+func (s *Server) children(ref varRef) ([]dbgp.Property, error) {
+	e, err := s.evaluator()
+	if err != nil {
+		return nil, err
+	}
+	if ref.property == nil {
+		return e.ContextGet(s.ctx, ref.depth, ref.context)
+	}
+	if len(ref.property.Children) == 0 {
+		// not loaded yet
+		p, err := e.PropertyGet(s.ctx, ref.depth, ref.context, ref.property.Fullname)
+		if err != nil {
+			return nil, err
+		}
+		ref.property.Children = p.Children
+	}
+	return ref.property.Children, nil
+}
+
+// variable converts a property, allocating a reference for its children
+func (s *Server) variable(depth, context int, p *dbgp.Property) Variable {
+	v := Variable{
+		Name:             p.Name,
+		Value:            p.Value,
+		Type:             p.Type,
+		EvaluateName:     p.Fullname,
+		IndexedVariables: p.NumChildren,
+	}
+	if p.HasChildren || len(p.Children) > 0 {
+		v.VariablesReference = s.ref(varRef{depth: depth, context: context, property: p})
+		if v.Value == "" {
+			v.Value = p.Type
+		}
+	}
+	return v
+}
+
+func (s *Server) ref(r varRef) int {
+	s.lastRef++
+	s.refs[s.lastRef] = r
+	return s.lastRef
+}
+
+// stepper returns the client method for a stepping request, nil if the client
+// lacks the capability
+func (s *Server) stepper(command string) func(context.Context) (string, string, error) {
+	switch command {
+	case "next":
+		if st, ok := s.client.(dbgp.Stepper); ok {
+			return st.StepOver
+		}
+	case "stepIn":
+		if st, ok := s.client.(dbgp.Stepper); ok {
+			return st.StepInto
+		}
+	case "continue":
+		if r, ok := s.client.(dbgp.Runner); ok {
+			return r.Run
+		}
+	}
+	return nil
+}
+
+// evaluator returns the client's variable inspection capability
+func (s *Server) evaluator() (dbgp.Evaluator, error) {
+	e, ok := s.client.(dbgp.Evaluator)
+	if !ok {
+		return nil, fmt.Errorf("the engine cannot inspect variables")
+	}
+	return e, nil
+}
+
+// continuation runs a stepping command and reports the outcome as an event
+func (s *Server) continuation(step func(context.Context) (string, string, error), reason string) {
+	status, why, err := step(s.ctx)
+	// references are only valid while stopped
+	s.refs = make(map[int]varRef)
+	if err != nil {
+		// the state of the engine is unknown, let the user look around
+		s.event("output", OutputEvent{Category: "stderr", Output: err.Error() + "\n"})
+		s.event("stopped", StoppedEvent{Reason: "pause", Description: "error", Text: err.Error(), ThreadID: 1, AllThreadsStopped: true})
+		return
+	}
+	var msg *dbgp.Message
+	if sr, ok := s.client.(dbgp.StopReporter); ok {
+		msg = sr.LastStop()
+	}
+	switch status {
+	case "stopping", "stopped":
+		if msg != nil && msg.ExitCode != nil {
+			s.event("exited", ExitedEvent{ExitCode: *msg.ExitCode})
+		}
+		s.event("terminated", nil)
+	default:
+		ev := StoppedEvent{Reason: reason, ThreadID: 1, AllThreadsStopped: true}
+		if why == "exception" {
+			ev.Reason = "exception"
+		}
+		if msg != nil {
+			ev.Description, ev.Text = msg.Exception, msg.Text
+		}
+		s.event("stopped", ev)
+	}
+}
+
+func (s *Server) respond(req *Packet, body interface{}, err error) error {
+	p := &Packet{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil}
+	if err != nil {
+		p.Message = err.Error()
+	}
+	return s.send(p, body)
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	return s.send(&Packet{Type: "event", Event: name}, body)
+}
+
+func (s *Server) send(p *Packet, body interface{}) error {
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		p.Body = b
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	p.Seq = s.seq
+	glog.V(2).Infoln("[dap] ->", p.Type, p.Command, p.Event, string(p.Body))
+	return WritePacket(s.w, p)
+}
@@ -0,0 +1,120 @@
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// breakpointClient records the breakpoints set on and removed from it
+type breakpointClient struct {
+	set     []string // "path:line"
+	removed []int
+}
+
+func (c *breakpointClient) Init(ctx context.Context) (dbgp.InitResponse, error) {
+	return dbgp.InitResponse{Language: "test"}, nil
+}
+
+func (c *breakpointClient) Status(ctx context.Context) (string, error) {
+	return "break", nil
+}
+
+func (c *breakpointClient) BreakpointSet(ctx context.Context, bpType, fileName string, line int) (dbgp.Breakpoint, error) {
+	c.set = append(c.set, fmt.Sprintf("%s:%d", fileName, line))
+	return dbgp.Breakpoint{ID: len(c.set), State: "enabled"}, nil
+}
+
+func (c *breakpointClient) BreakpointRemove(ctx context.Context, id int) error {
+	c.removed = append(c.removed, id)
+	return nil
+}
+
+// serve has a server with the path mappings handle the requests, returning
+// its responses by request
+func serve(t *testing.T, client dbgp.DBGPClient, paths dbgp.PathMap, requests ...*Packet) map[int]*Packet {
+	var in, out bytes.Buffer
+	w := bufio.NewWriter(&in)
+	for _, p := range requests {
+		if err := WritePacket(w, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewServer(struct {
+		io.Reader
+		io.Writer
+	}{&in, &out}, func(string, json.RawMessage) (dbgp.DBGPClient, error) { return client, nil })
+	s.Paths = paths
+	if err := s.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	responses := make(map[int]*Packet)
+	r := bufio.NewReader(&out)
+	for {
+		p, err := ReadPacket(r)
+		if err == io.EOF {
+			return responses
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Type == "response" {
+			responses[p.RequestSeq] = p
+		}
+	}
+}
+
+// request creates a request packet, failing the test if args do not marshal
+func request(t *testing.T, seq int, command string, args interface{}) *Packet {
+	p, err := NewRequest(seq, command, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// setBreakpoints creates a setBreakpoints request for the lines of path
+func setBreakpoints(t *testing.T, seq int, path string, lines ...int) *Packet {
+	bps := make([]SourceBreakpoint, len(lines))
+	for i, l := range lines {
+		bps[i] = SourceBreakpoint{Line: l}
+	}
+	return request(t, seq, "setBreakpoints", map[string]interface{}{
+		"source":      Source{Path: path},
+		"breakpoints": bps,
+	})
+}
+
+func TestSetBreakpoints(t *testing.T) {
+	var paths dbgp.PathMap
+	if err := paths.Set("/home/me/src=/src"); err != nil {
+		t.Fatal(err)
+	}
+	client := new(breakpointClient)
+	requests := []*Packet{
+		request(t, 1, "initialize", nil),
+		request(t, 2, "launch", nil),
+		setBreakpoints(t, 3, "/home/me/src/main.c", 5),
+		setBreakpoints(t, 4, "/home/me/src/main.c", 5, 7),
+		setBreakpoints(t, 5, "/home/me/src/main.c", 7),
+		setBreakpoints(t, 6, "/home/me/src/main.c", 5),
+	}
+	responses := serve(t, client, paths, requests...)
+	for _, r := range requests {
+		if p := responses[r.Seq]; p == nil || !p.Success {
+			t.Fatalf("%s %d failed: %+v", r.Command, r.Seq, p)
+		}
+	}
+	if want := []string{"/src/main.c:5", "/src/main.c:7", "/src/main.c:5"}; !reflect.DeepEqual(client.set, want) {
+		t.Errorf("set breakpoints %q, want %q", client.set, want)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(client.removed, want) {
+		t.Errorf("removed breakpoints %v, want %v", client.removed, want)
+	}
+}
@@ -0,0 +1,84 @@
+// Program dap2dbgp implements a dbgp to Debug Adapter Protocol proxy
+//
+// dap2dbgp [flags] -launch '{"program": "main.py"}' -- (adapter command) [adapter args...]
+//
+// for example, with debugpy:
+//
+// dap2dbgp -adapter-id python -launch '{"program": "main.py", "stopOnEntry": true}' -- python -m debugpy.adapter
+//
+// note: invoke with the following options to debug: -v=2 -logtostderr
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/traviscline/dbgp/dapproxy"
+	"github.com/traviscline/dbgp/internal/cli"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var engine = cli.EngineFlags(flag.CommandLine)
+var launch = flag.String("launch", "{}", "JSON arguments for the adapter's launch request, or @file to read them from a file")
+var adapterID = flag.String("adapter-id", "dbgp", "adapterID sent to the debug adapter")
+var language = flag.String("language", "", "language reported to the IDE (defaults to the adapter id)")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [--] adapter [adapter args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "No debug adapter specified")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	launchArgs := []byte(*launch)
+	if strings.HasPrefix(*launch, "@") {
+		b, err := ioutil.ReadFile(strings.TrimPrefix(*launch, "@"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading launch arguments:", err)
+			os.Exit(1)
+		}
+		launchArgs = b
+	}
+	if !json.Valid(launchArgs) {
+		fmt.Fprintln(os.Stderr, "Invalid launch arguments, expected JSON")
+		os.Exit(1)
+	}
+
+	secret, err := engine.Secret()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading secret:", err)
+		os.Exit(1)
+	}
+
+	c, err := engine.Connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error connecting to IDE:", err)
+		os.Exit(1)
+	}
+
+	opts := []dapproxy.Option{dapproxy.WithAdapterID(*adapterID)}
+	if *language != "" {
+		opts = append(opts, dapproxy.WithLanguage(*language))
+	}
+	ideKey, session := os.Getenv("DBGP_IDEKEY"), os.Getenv("DBGP_COOKIE")
+	p, err := dapproxy.New(flag.Args(), launchArgs, ideKey, session, opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error creating proxy:", err)
+		os.Exit(1)
+	}
+	defer p.Close()
+
+	conn := engine.NewConn(c, p, secret)
+	if err := conn.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error running proxy:", err)
+		p.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,673 @@
+// Package dapproxy implements a dbgp.DBGPClient that is backed by any Debug
+// Adapter Protocol (DAP) adapter, such as debugpy, lldb-dap, dlv dap or
+// js-debug, running as a subprocess
+package dapproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/dap"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long to wait for the adapter to answer a request
+var requestTimeout = 30 * time.Second
+
+// DAP implements the dbgp.DBGPClient protocol and manages a debug adapter
+type DAP struct {
+	status          string // ("starting", "stopping", "running", "break")
+	ideKey, session string
+	features        dbgp.Features
+	adapterID       string
+	launch          json.RawMessage
+
+	cmd *exec.Cmd
+	w   *bufio.Writer
+
+	mu      sync.Mutex // guards seq, pending and w
+	seq     int
+	pending map[int]chan *dap.Packet
+	events  chan *dap.Packet
+
+	launched chan *dap.Packet // launch response, which some adapters delay until configurationDone
+
+	threadID    int
+	frames      []dap.StackFrame
+	scopes      map[int][]dap.Scope // by stack depth
+	refs        map[string]int      // variablesReference by fullname
+	breakpoints map[string][]int    // lines by source path
+	bpIDs       map[string]int      // dbgp breakpoint ID by "path:line"
+	adapterBps  map[int]int         // dbgp breakpoint ID by the adapter's
+	lastBpID    int
+	lastStop    *dbgp.Message
+}
+
+// Option configures the debug adapter session
+type Option func(*DAP)
+
+// WithAdapterID sets the adapterID sent in the initialize request, e.g.
+// "python" or "go"
+func WithAdapterID(id string) Option {
+	return func(d *DAP) { d.adapterID = id }
+}
+
+// WithLanguage sets the language reported to the IDE
+func WithLanguage(lang string) Option {
+	return func(d *DAP) { d.features.Language_name = lang }
+}
+
+// New starts the debug adapter given by adapter (the command line) and
+// prepares a session that launches the program described by launch, the
+// adapter specific arguments of DAP's launch request
+func New(adapter []string, launch json.RawMessage, ideKey, session string, opts ...Option) (*DAP, error) {
+	if len(adapter) == 0 {
+		return nil, fmt.Errorf("no debug adapter specified")
+	}
+	if len(launch) == 0 {
+		launch = json.RawMessage("{}")
+	}
+	d := &DAP{
+		status:      "starting",
+		ideKey:      ideKey,
+		session:     session,
+		adapterID:   "dbgp",
+		launch:      launch,
+		pending:     make(map[int]chan *dap.Packet),
+		events:      make(chan *dap.Packet, 64),
+		scopes:      make(map[int][]dap.Scope),
+		refs:        make(map[string]int),
+		breakpoints: make(map[string][]int),
+		bpIDs:       make(map[string]int),
+		adapterBps:  make(map[int]int),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.features.Language_name == "" {
+		d.features.Language_name = d.adapterID
+	}
+
+	cmd := exec.Command(adapter[0], adapter[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	d.cmd = cmd
+	d.w = bufio.NewWriter(stdin)
+	go d.readLoop(bufio.NewReader(stdout))
+	return d, nil
+}
+
+// Init is invoked to begin the session with the upstream IDE or proxy
+func (d *DAP) Init(ctx context.Context) (dbgp.InitResponse, error) {
+	_, err := d.request(ctx, "initialize", map[string]interface{}{
+		"clientID":        "dbgp",
+		"adapterID":       d.adapterID,
+		"linesStartAt1":   true,
+		"columnsStartAt1": true,
+		"pathFormat":      "path",
+	})
+	if err != nil {
+		return dbgp.InitResponse{}, err
+	}
+	// the launch response may only arrive after configurationDone
+	d.launched, err = d.send("launch", d.launch)
+	if err != nil {
+		return dbgp.InitResponse{}, err
+	}
+	if _, err := d.waitEvent(ctx, "initialized"); err != nil {
+		return dbgp.InitResponse{}, err
+	}
+
+	var program struct {
+		Program string `json:"program"`
+	}
+	json.Unmarshal(d.launch, &program)
+	return dbgp.InitResponse{
+		AppID:    "dapproxy",
+		IDeKey:   d.ideKey,
+		Session:  d.session,
+		Thread:   "1",
+		Language: d.features.Language_name,
+		FileURI:  program.Program,
+	}, nil
+}
+
+func (d *DAP) Status(ctx context.Context) (string, error) {
+	return d.status, nil
+}
+
+func (d *DAP) Features() dbgp.Features {
+	return d.features
+}
+
+// finishes configuration, the adapter starts running the program
+func (d *DAP) start(ctx context.Context) (status, reason string, err error) {
+	if _, err := d.request(ctx, "configurationDone", nil); err != nil {
+		return "", "", err
+	}
+	select {
+	case p := <-d.launched:
+		if p != nil && !p.Success {
+			d.status = "stopping"
+			return "", "", fmt.Errorf("launch failed: %s", p.Message)
+		}
+	case <-time.After(requestTimeout):
+		glog.Warningln("[dapproxy] no launch response")
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+	return d.waitStop(ctx)
+}
+
+func (d *DAP) StepInto(ctx context.Context) (status, reason string, err error) {
+	if d.status == "starting" {
+		return d.start(ctx)
+	}
+	return d.step(ctx, "stepIn")
+}
+
+func (d *DAP) StepOver(ctx context.Context) (status, reason string, err error) {
+	if d.status == "starting" {
+		return d.start(ctx)
+	}
+	return d.step(ctx, "next")
+}
+
+func (d *DAP) Run(ctx context.Context) (status, reason string, err error) {
+	if d.status == "starting" {
+		return d.start(ctx)
+	}
+	return d.step(ctx, "continue")
+}
+
+func (d *DAP) step(ctx context.Context, command string) (status, reason string, err error) {
+	if _, err := d.request(ctx, command, map[string]interface{}{"threadId": d.threadID}); err != nil {
+		return "", "", err
+	}
+	return d.waitStop(ctx)
+}
+
+// waits until the program stops or terminates. When ctx is done first, the
+// program is paused and ctx's error returned once it stopped.
+func (d *DAP) waitStop(ctx context.Context) (status, reason string, err error) {
+	d.status = "running"
+	d.lastStop = nil
+	done := ctx.Done()
+	for {
+		var p *dap.Packet
+		select {
+		case p = <-d.events:
+		case <-done:
+			done = nil
+			if _, err := d.send("pause", map[string]interface{}{"threadId": d.threadID}); err != nil {
+				glog.Warningln("[dapproxy] pause:", err)
+			}
+			continue
+		}
+		if p == nil {
+			d.status = "stopping"
+			return "", "", fmt.Errorf("debug adapter exited")
+		}
+		if done == nil && (p.Event == "stopped" || p.Event == "terminated") {
+			if p.Event == "stopped" {
+				d.invalidate()
+				d.status = "break"
+			} else {
+				d.status = "stopping"
+			}
+			return "", "", ctx.Err()
+		}
+		switch p.Event {
+		case "stopped":
+			var ev dap.StoppedEvent
+			json.Unmarshal(p.Body, &ev)
+			if ev.ThreadID != 0 {
+				d.threadID = ev.ThreadID
+			}
+			d.invalidate()
+			d.status = "break"
+			d.lastStop = d.stopOf(ctx, ev)
+			if ev.Reason == "exception" {
+				return d.status, "exception", nil
+			}
+			return d.status, "ok", nil
+		case "terminated":
+			d.status = "stopping"
+			return d.status, "ok", nil
+		}
+	}
+}
+
+// LastStop describes why the program stopped after the last continuation
+func (d *DAP) LastStop() *dbgp.Message {
+	return d.lastStop
+}
+
+// describes a stop, finding the breakpoint hit by its location if the
+// adapter does not tell
+func (d *DAP) stopOf(ctx context.Context, ev dap.StoppedEvent) *dbgp.Message {
+	m := &dbgp.Message{Text: ev.Description}
+	for _, id := range ev.HitBreakpointIDs {
+		if bp, ok := d.adapterBps[id]; ok {
+			m.BreakpointID = bp
+			break
+		}
+	}
+	if frames, err := d.stackTrace(ctx); err == nil && len(frames) > 0 && frames[0].Source != nil {
+		m.Filename, m.Lineno = frames[0].Source.Path, frames[0].Line
+		if m.BreakpointID == 0 && ev.Reason == "breakpoint" {
+			m.BreakpointID = d.bpIDs[fmt.Sprintf("%s:%d", m.Filename, m.Lineno)]
+		}
+	}
+	return m
+}
+
+// drops state that is only valid while stopped
+func (d *DAP) invalidate() {
+	d.frames = nil
+	d.scopes = make(map[int][]dap.Scope)
+	d.refs = make(map[string]int)
+}
+
+func (d *DAP) StackDepth(ctx context.Context) (int, error) {
+	frames, err := d.stackTrace(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(frames), nil
+}
+
+func (d *DAP) StackGet(ctx context.Context, depth int) ([]dbgp.Stack, error) {
+	frames, err := d.stackTrace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stack := make([]dbgp.Stack, len(frames))
+	for i, f := range frames {
+		var fileName string
+		if f.Source != nil {
+			fileName = f.Source.Path
+		}
+		stack[i] = dbgp.Stack{
+			Level:    i,
+			Type:     "file",
+			Filename: fileName,
+			Lineno:   f.Line,
+			Where:    f.Name,
+		}
+	}
+	return stack, nil
+}
+
+func (d *DAP) stackTrace(ctx context.Context) ([]dap.StackFrame, error) {
+	if d.frames != nil {
+		return d.frames, nil
+	}
+	var body struct {
+		StackFrames []dap.StackFrame `json:"stackFrames"`
+	}
+	if err := d.requestBody(ctx, "stackTrace", map[string]interface{}{"threadId": d.threadID}, &body); err != nil {
+		return nil, err
+	}
+	d.frames = body.StackFrames
+	return d.frames, nil
+}
+
+func (d *DAP) ContextNames(ctx context.Context, depth int) ([]dbgp.Context, error) {
+	scopes, err := d.scopesAt(ctx, depth)
+	if err != nil {
+		return nil, err
+	}
+	contexts := make([]dbgp.Context, len(scopes))
+	for i, s := range scopes {
+		contexts[i] = dbgp.Context{Name: s.Name, ID: i}
+	}
+	return contexts, nil
+}
+
+func (d *DAP) scopesAt(ctx context.Context, depth int) ([]dap.Scope, error) {
+	if s, ok := d.scopes[depth]; ok {
+		return s, nil
+	}
+	frames, err := d.stackTrace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if depth < 0 || depth >= len(frames) {
+		return nil, dbgp.ErrInvalidOpts
+	}
+	var body struct {
+		Scopes []dap.Scope `json:"scopes"`
+	}
+	if err := d.requestBody(ctx, "scopes", map[string]interface{}{"frameId": frames[depth].ID}, &body); err != nil {
+		return nil, err
+	}
+	d.scopes[depth] = body.Scopes
+	return body.Scopes, nil
+}
+
+func (d *DAP) ContextGet(ctx context.Context, depth, context int) ([]dbgp.Property, error) {
+	scopes, err := d.scopesAt(ctx, depth)
+	if err != nil {
+		return nil, err
+	}
+	if context < 0 || context >= len(scopes) {
+		return nil, dbgp.ErrInvalidOpts
+	}
+	return d.variables(ctx, scopes[context].VariablesReference, "")
+}
+
+func (d *DAP) PropertyGet(ctx context.Context, depth, context int, name string) (dbgp.Property, error) {
+	ref, ok := d.refs[name]
+	if !ok {
+		// look the name up among the context's variables
+		properties, err := d.ContextGet(ctx, depth, context)
+		if err != nil {
+			return dbgp.Property{}, err
+		}
+		for _, p := range properties {
+			if p.Fullname == name && !p.HasChildren {
+				return p, nil
+			}
+		}
+		ref, ok = d.refs[name]
+	}
+	if !ok {
+		return d.evaluate(ctx, depth, name)
+	}
+	children, err := d.variables(ctx, ref, name)
+	if err != nil {
+		return dbgp.Property{}, err
+	}
+	return dbgp.Property{
+		Name:        name,
+		Fullname:    name,
+		HasChildren: true,
+		NumChildren: len(children),
+		Children:    children,
+	}, nil
+}
+
+// evaluates an expression in the given frame
+func (d *DAP) evaluate(ctx context.Context, depth int, expr string) (dbgp.Property, error) {
+	args := map[string]interface{}{"expression": expr, "context": "watch"}
+	if frames, err := d.stackTrace(ctx); err == nil && depth >= 0 && depth < len(frames) {
+		args["frameId"] = frames[depth].ID
+	}
+	var body struct {
+		Result             string `json:"result"`
+		Type               string `json:"type"`
+		VariablesReference int    `json:"variablesReference"`
+	}
+	if err := d.requestBody(ctx, "evaluate", args, &body); err != nil {
+		return dbgp.Property{}, err
+	}
+	p := dbgp.Property{Name: expr, Fullname: expr, Type: body.Type, Value: body.Result}
+	if body.VariablesReference > 0 {
+		d.refs[expr] = body.VariablesReference
+		children, err := d.variables(ctx, body.VariablesReference, expr)
+		if err != nil {
+			return dbgp.Property{}, err
+		}
+		p.Children = children
+		p.NumChildren = len(children)
+		p.HasChildren = true
+	}
+	return p, nil
+}
+
+// fetches the variables behind a variablesReference, remembering the
+// references of structured children
+func (d *DAP) variables(ctx context.Context, ref int, parent string) ([]dbgp.Property, error) {
+	var body struct {
+		Variables []dap.Variable `json:"variables"`
+	}
+	if err := d.requestBody(ctx, "variables", map[string]interface{}{"variablesReference": ref}, &body); err != nil {
+		return nil, err
+	}
+	properties := make([]dbgp.Property, len(body.Variables))
+	for i, v := range body.Variables {
+		fullname := v.EvaluateName
+		switch {
+		case fullname != "":
+		case parent == "":
+			fullname = v.Name
+		case strings.HasPrefix(v.Name, "["):
+			fullname = parent + v.Name
+		default:
+			fullname = parent + "." + v.Name
+		}
+		if v.VariablesReference > 0 {
+			d.refs[fullname] = v.VariablesReference
+		}
+		properties[i] = dbgp.Property{
+			Name:        v.Name,
+			Fullname:    fullname,
+			Type:        v.Type,
+			Value:       v.Value,
+			HasChildren: v.VariablesReference > 0,
+			NumChildren: v.NamedVariables + v.IndexedVariables,
+			Address:     v.MemoryReference,
+		}
+	}
+	return properties, nil
+}
+
+// BreakpointSet sets a line breakpoint, answering with the adapter's ID
+// unless another breakpoint has it already, and disabled if the adapter
+// could not verify it
+func (d *DAP) BreakpointSet(ctx context.Context, bpType, fileName string, lineNumber int) (dbgp.Breakpoint, error) {
+	if bpType != "line" {
+		return dbgp.Breakpoint{}, fmt.Errorf("only line breakpoints are supported.")
+	}
+	// setBreakpoints replaces all breakpoints of a source
+	lines := d.breakpoints[fileName]
+	index := -1
+	for i, l := range lines {
+		if l == lineNumber {
+			index = i
+		}
+	}
+	if index < 0 {
+		lines = append(lines, lineNumber)
+		index = len(lines) - 1
+	}
+	bps := make([]dap.SourceBreakpoint, len(lines))
+	for i, l := range lines {
+		bps[i] = dap.SourceBreakpoint{Line: l}
+	}
+	var body struct {
+		Breakpoints []dap.Breakpoint `json:"breakpoints"`
+	}
+	err := d.requestBody(ctx, "setBreakpoints", map[string]interface{}{
+		"source":      dap.Source{Path: fileName},
+		"breakpoints": bps,
+	}, &body)
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	d.breakpoints[fileName] = lines
+
+	var adapterBp dap.Breakpoint
+	if index < len(body.Breakpoints) {
+		adapterBp = body.Breakpoints[index]
+	}
+	key := fmt.Sprintf("%s:%d", fileName, lineNumber)
+	id, ok := d.bpIDs[key]
+	if !ok {
+		id = d.newBpID(adapterBp.ID)
+		d.bpIDs[key] = id
+	}
+	for i, bp := range body.Breakpoints {
+		if i < len(lines) && bp.ID != 0 {
+			d.adapterBps[bp.ID] = d.bpIDs[fmt.Sprintf("%s:%d", fileName, lines[i])]
+		}
+	}
+	if !adapterBp.Verified {
+		glog.V(1).Infoln("[dapproxy] unverified breakpoint:", key, adapterBp.Message)
+		return dbgp.Breakpoint{ID: id, State: "disabled"}, nil
+	}
+	return dbgp.Breakpoint{ID: id, State: "enabled"}, nil
+}
+
+// newBpID returns the ID of a new breakpoint: the adapter's if it has one no
+// other breakpoint has, otherwise the next unused one
+func (d *DAP) newBpID(adapterID int) int {
+	taken := adapterID == 0
+	for _, id := range d.bpIDs {
+		taken = taken || id == adapterID
+	}
+	if !taken {
+		if adapterID > d.lastBpID {
+			d.lastBpID = adapterID
+		}
+		return adapterID
+	}
+	// the IDs given out are at most lastBpID
+	d.lastBpID++
+	return d.lastBpID
+}
+
+// Close disconnects from the adapter, terminating the program
+func (d *DAP) Close() error {
+	d.request(context.Background(), "disconnect", map[string]interface{}{"terminateDebuggee": true})
+	return d.cmd.Wait()
+}
+
+// sends a request and waits for its successful response, decoding the body
+// into v
+func (d *DAP) requestBody(ctx context.Context, command string, args, v interface{}) error {
+	p, err := d.request(ctx, command, args)
+	if err != nil {
+		return err
+	}
+	if v == nil || len(p.Body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(p.Body, v)
+}
+
+// sends a request and waits for its successful response
+func (d *DAP) request(ctx context.Context, command string, args interface{}) (*dap.Packet, error) {
+	c, err := d.send(command, args)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case p, ok := <-c:
+		if !ok {
+			return nil, fmt.Errorf("debug adapter exited")
+		}
+		if !p.Success {
+			return nil, fmt.Errorf("%s failed: %s", command, p.Message)
+		}
+		return p, nil
+	case <-time.After(requestTimeout):
+		return nil, fmt.Errorf("timed out waiting for %s response", command)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// sends a request, the response is delivered to the returned channel
+func (d *DAP) send(command string, args interface{}) (chan *dap.Packet, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	c := make(chan *dap.Packet, 1)
+	d.pending[d.seq] = c
+	glog.V(2).Infoln("[dapproxy] ->", command, args)
+	p, err := dap.NewRequest(d.seq, command, args)
+	if err != nil {
+		delete(d.pending, d.seq)
+		return nil, err
+	}
+	if err := dap.WritePacket(d.w, p); err != nil {
+		delete(d.pending, d.seq)
+		return nil, err
+	}
+	return c, nil
+}
+
+// waits for the named event, discarding others
+func (d *DAP) waitEvent(ctx context.Context, name string) (*dap.Packet, error) {
+	timeout := time.After(requestTimeout)
+	for {
+		select {
+		case p, ok := <-d.events:
+			if !ok {
+				return nil, fmt.Errorf("debug adapter exited")
+			}
+			if p.Event == name {
+				return p, nil
+			}
+		case <-timeout:
+			return nil, fmt.Errorf("timed out waiting for %s event", name)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// dispatches responses to their requests and queues events
+func (d *DAP) readLoop(r *bufio.Reader) {
+	defer func() {
+		d.mu.Lock()
+		for seq, c := range d.pending {
+			close(c)
+			delete(d.pending, seq)
+		}
+		d.mu.Unlock()
+		close(d.events)
+	}()
+	for {
+		p, err := dap.ReadPacket(r)
+		if err != nil {
+			glog.V(1).Infoln("[dapproxy] read:", err)
+			return
+		}
+		glog.V(2).Infoln("[dapproxy] <-", p.Type, p.Command, p.Event, string(p.Body))
+		switch p.Type {
+		case "response":
+			d.mu.Lock()
+			c, ok := d.pending[p.RequestSeq]
+			delete(d.pending, p.RequestSeq)
+			d.mu.Unlock()
+			if ok {
+				c <- p
+			}
+		case "event":
+			switch p.Event {
+			case "initialized", "stopped", "terminated":
+				d.events <- p
+			case "output":
+				var ev dap.OutputEvent
+				json.Unmarshal(p.Body, &ev)
+				glog.V(1).Infoln("[dapproxy] output:", strings.TrimSuffix(ev.Output, "\n"))
+			}
+		case "request":
+			// reverse requests such as runInTerminal are not supported
+			d.mu.Lock()
+			d.seq++
+			dap.WritePacket(d.w, &dap.Packet{Seq: d.seq, Type: "response", RequestSeq: p.Seq, Command: p.Command, Message: "not supported"})
+			d.mu.Unlock()
+		}
+	}
+}
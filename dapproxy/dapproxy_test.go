@@ -0,0 +1,27 @@
+package dapproxy
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewBpID(t *testing.T) {
+	d := &DAP{bpIDs: make(map[string]int)}
+	for i, tt := range []struct {
+		adapterID, want int
+	}{
+		{0, 1},   // the adapter has no IDs
+		{5, 5},   // the adapter's
+		{5, 6},   // taken
+		{3, 3},   // free below the last one
+		{0, 7},   // after the adapter's
+		{7, 8},   // taken
+		{20, 20}, // far ahead
+	} {
+		id := d.newBpID(tt.adapterID)
+		if id != tt.want {
+			t.Errorf("breakpoint %d with adapter ID %d: got ID %d, want %d", i, tt.adapterID, id, tt.want)
+		}
+		d.bpIDs[fmt.Sprintf("/src/main.c:%d", i+1)] = id
+	}
+}
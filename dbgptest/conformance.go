@@ -0,0 +1,236 @@
+package dbgptest
+
+import (
+	"encoding/xml"
+	"github.com/traviscline/dbgp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Valid values of the status and reason attributes
+var (
+	statuses = map[string]bool{"starting": true, "stopping": true, "stopped": true, "running": true, "break": true}
+	reasons  = map[string]bool{"ok": true, "error": true, "aborted": true, "exception": true}
+)
+
+// Conformance runs the conformance suite against clients created by
+// newClient, verifying the wire format of each command against the DBGP spec.
+// Each subtest gets a fresh client, newClient should register any cleanup
+// with t.Cleanup.
+//
+// The client must be able to stop somewhere with at least one stack frame
+// after a single step_into. A backend package calls it from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		dbgptest.Conformance(t, func(t *testing.T) dbgp.DBGPClient {
+//			g, err := gdbproxy.New("testdata/prog", "", "")
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return g
+//		})
+//	}
+func Conformance(t *testing.T, newClient func(t *testing.T) dbgp.DBGPClient) {
+	run := func(name string, f func(t *testing.T, ide *IDE)) {
+		t.Run(name, func(t *testing.T) {
+			ide, err := NewIDE(newClient(t))
+			if err != nil {
+				t.Fatal("connecting:", err)
+			}
+			defer ide.Close()
+			f(t, ide)
+		})
+	}
+
+	run("init", func(t *testing.T, ide *IDE) {
+		init := ide.Init
+		if init.XMLName.Local != "init" {
+			t.Errorf("init packet root is <%s>, want <init>", init.XMLName.Local)
+		}
+		if init.XMLName.Space != "urn:debugger_protocol_v1" {
+			t.Errorf("init packet namespace is %q, want urn:debugger_protocol_v1", init.XMLName.Space)
+		}
+		for _, attr := range []string{"appid", "idekey", "session", "thread", "language", "protocol_version", "fileuri"} {
+			if !hasAttr(init.Attrs, attr) {
+				t.Errorf("init packet lacks %s attribute", attr)
+			}
+		}
+		if init.FileURI != "" && !strings.HasPrefix(init.FileURI, "file://") {
+			t.Errorf("fileuri %q is not a file URI", init.FileURI)
+		}
+	})
+
+	run("status", func(t *testing.T, ide *IDE) {
+		resp := command(t, ide, "status")
+		checkStatus(t, resp)
+	})
+
+	run("feature_get", func(t *testing.T, ide *IDE) {
+		resp := command(t, ide, "feature_get", "-n", "language_name")
+		if v, _ := resp.Attr("feature_name"); v != "language_name" {
+			t.Errorf("feature_name = %q, want language_name", v)
+		}
+		if v, _ := resp.Attr("supported"); v != "0" && v != "1" {
+			t.Errorf("supported = %q, want 0 or 1", v)
+		}
+	})
+
+	run("unknown command", func(t *testing.T, ide *IDE) {
+		resp, err := ide.Command("x_no_such_command")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEnvelope(t, resp, "x_no_such_command", ide.txID)
+		if resp.Error == nil {
+			t.Fatalf("no error element in %s", resp.Raw)
+		}
+		if resp.Error.Code != 4 {
+			t.Errorf("error code = %d, want 4 (unimplemented command)", resp.Error.Code)
+		}
+	})
+
+	run("step_into", func(t *testing.T, ide *IDE) {
+		resp := command(t, ide, "step_into")
+		checkStatus(t, resp)
+	})
+
+	run("stack", func(t *testing.T, ide *IDE) {
+		command(t, ide, "step_into")
+
+		resp := command(t, ide, "stack_depth")
+		v, ok := resp.Attr("depth")
+		if !ok {
+			t.Fatalf("stack_depth response lacks depth attribute: %s", resp.Raw)
+		}
+		if d, err := strconv.Atoi(v); err != nil || d < 1 {
+			t.Errorf("depth = %q, want a positive integer", v)
+		}
+
+		resp = command(t, ide, "stack_get", "-d", "0")
+		if len(resp.Stack) == 0 {
+			t.Fatalf("no stack elements in %s", resp.Raw)
+		}
+		for i, s := range resp.Stack {
+			if s.Type != "file" && s.Type != "eval" {
+				t.Errorf("stack[%d] type = %q, want file or eval", i, s.Type)
+			}
+			if s.Filename != "" && !strings.Contains(s.Filename, "://") {
+				t.Errorf("stack[%d] filename %q is not a URI", i, s.Filename)
+			}
+		}
+	})
+
+	run("context", func(t *testing.T, ide *IDE) {
+		command(t, ide, "step_into")
+
+		resp := command(t, ide, "context_names", "-d", "0")
+		if len(resp.Contexts) == 0 {
+			t.Fatalf("no context elements in %s", resp.Raw)
+		}
+		for i, c := range resp.Contexts {
+			if c.Name == "" {
+				t.Errorf("context[%d] has no name", i)
+			}
+		}
+
+		ctx := strconv.Itoa(resp.Contexts[0].ID)
+		resp = command(t, ide, "context_get", "-d", "0", "-c", ctx)
+		if v, _ := resp.Attr("context"); v != ctx {
+			t.Errorf("context attribute = %q, want %s", v, ctx)
+		}
+		checkProperties(t, resp.Properties)
+
+		if len(resp.Properties) > 0 {
+			name := resp.Properties[0].Fullname
+			resp = command(t, ide, "property_get", "-d", "0", "-c", ctx, "-n", name)
+			if len(resp.Properties) != 1 {
+				t.Fatalf("property_get returned %d properties, want 1: %s", len(resp.Properties), resp.Raw)
+			}
+			checkProperties(t, resp.Properties)
+		}
+	})
+
+	run("breakpoint_set", func(t *testing.T, ide *IDE) {
+		file := ide.Init.FileURI
+		if file == "" {
+			t.Skip("no fileuri in init packet")
+		}
+		resp := command(t, ide, "breakpoint_set", "-t", "line", "-f", file, "-n", "1")
+		id, ok := resp.Attr("id")
+		if !ok {
+			t.Fatalf("breakpoint_set response lacks id attribute: %s", resp.Raw)
+		}
+		if id == "" {
+			t.Errorf("empty breakpoint id")
+		}
+		if v, _ := resp.Attr("state"); v != "enabled" && v != "disabled" {
+			t.Errorf("state = %q, want enabled or disabled", v)
+		}
+	})
+}
+
+// command sends a command, failing the test on transport errors and error
+// responses
+func command(t *testing.T, ide *IDE, name string, args ...string) *Response {
+	t.Helper()
+	resp, err := ide.Command(name, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	checkEnvelope(t, resp, name, ide.txID)
+	if resp.Error != nil {
+		t.Fatalf("%s: error response %d: %s", name, resp.Error.Code, resp.Error.Message)
+	}
+	return resp
+}
+
+// checkEnvelope checks the attributes every response carries
+func checkEnvelope(t *testing.T, resp *Response, command string, txID int) {
+	t.Helper()
+	if resp.XMLName.Local != "response" {
+		t.Errorf("root element is <%s>, want <response>", resp.XMLName.Local)
+	}
+	if resp.XMLName.Space != "urn:debugger_protocol_v1" {
+		t.Errorf("namespace is %q, want urn:debugger_protocol_v1", resp.XMLName.Space)
+	}
+	if resp.Command != command {
+		t.Errorf("command = %q, want %q", resp.Command, command)
+	}
+	if resp.TransactionID != strconv.Itoa(txID) {
+		t.Errorf("transaction_id = %q, want %d", resp.TransactionID, txID)
+	}
+}
+
+// checkStatus checks the status and reason attributes
+func checkStatus(t *testing.T, resp *Response) {
+	t.Helper()
+	if !statuses[resp.Status] {
+		t.Errorf("status = %q, want one of starting, stopping, stopped, running, break", resp.Status)
+	}
+	if !reasons[resp.Reason] {
+		t.Errorf("reason = %q, want one of ok, error, aborted, exception", resp.Reason)
+	}
+}
+
+func checkProperties(t *testing.T, properties []dbgp.Property) {
+	t.Helper()
+	for _, p := range properties {
+		if p.Name == "" {
+			t.Errorf("property without name: %+v", p)
+		}
+		if p.NumChildren < len(p.Children) {
+			t.Errorf("property %s has %d children but numchildren=%d", p.Name, len(p.Children), p.NumChildren)
+		}
+		checkProperties(t, p.Children)
+	}
+}
+
+func hasAttr(attrs []xml.Attr, name string) bool {
+	for _, a := range attrs {
+		if a.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,449 @@
+// Package dbgptest provides utilities for testing DBGP engines and
+// dbgp.DBGPClient implementations: a scriptable fake client, an in-process IDE
+// simulator driving a dbgp.Conn and a conformance suite for backends.
+package dbgptest
+
+import (
+	"context"
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Scope identifies the properties of one context at one stack depth
+type Scope struct {
+	Depth, Context int
+}
+
+// Stop is the state of the fake engine after a continuation command
+type Stop struct {
+	Status string // defaults to "break"
+	Reason string // defaults to "ok"
+
+	Err     error         // returned by the continuation reaching the stop
+	Message *dbgp.Message // reported by LastStop
+	// Notifications pending once the stop is reached
+	Notifications []dbgp.Notification
+	Stack         []dbgp.Stack
+	Contexts      []dbgp.Context // defaults to a single "Locals" context
+	Properties    map[Scope][]dbgp.Property
+}
+
+// Engine is a scriptable, in-memory dbgp.DBGPClient. Every StepInto, StepOver
+// or Run advances to the next Stop; once they are exhausted the engine reports
+// "stopping". The backwards continuations return to the previous Stop.
+type Engine struct {
+	Info     dbgp.InitResponse
+	Language string
+	Stops    []Stop
+	Memory   map[uint64][]byte // regions served by ReadMemory, by start address
+	// Instructions served by Disassemble, by function, "" for the current one
+	Instructions map[string][]dbgp.Instruction
+	// Sources served by Source, by engine side path
+	Sources map[string]string
+
+	mu          sync.Mutex
+	current     int // index into Stops, -1 before the first continuation
+	started     bool
+	lastBpID    int
+	breakpoints []BreakpointRequest
+	calls       []string
+	streams     map[string]io.Writer
+	notes       []dbgp.Notification
+}
+
+// NewEngine creates an engine that runs through stops
+func NewEngine(stops ...Stop) *Engine {
+	return &Engine{
+		Info: dbgp.InitResponse{
+			AppID:    "dbgptest",
+			IDeKey:   "dbgptest",
+			Session:  "1",
+			Thread:   "1",
+			Language: "c",
+			FileURI:  "/src/main.c",
+		},
+		Language: "c",
+		Stops:    stops,
+		current:  -1,
+	}
+}
+
+// Calls returns the names of the methods invoked so far, in order
+func (e *Engine) Calls() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.calls...)
+}
+
+// BreakpointRequest records a successful BreakpointSet call
+type BreakpointRequest struct {
+	Type, Filename string
+	Line           int
+	Exception      string // for "exception" breakpoints
+	Expression     string // for watch breakpoints
+	Breakpoint     dbgp.Breakpoint
+}
+
+// Breakpoints returns the breakpoints set so far
+func (e *Engine) Breakpoints() []BreakpointRequest {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]BreakpointRequest(nil), e.breakpoints...)
+}
+
+func (e *Engine) record(call string) {
+	e.mu.Lock()
+	e.calls = append(e.calls, call)
+	e.mu.Unlock()
+}
+
+// stop returns the current stop, nil before the first continuation or after
+// the last one
+func (e *Engine) stop() *Stop {
+	if e.current < 0 || e.current >= len(e.Stops) {
+		return nil
+	}
+	s := &e.Stops[e.current]
+	if len(s.Contexts) == 0 {
+		s.Contexts = []dbgp.Context{{Name: "Locals", ID: 0}}
+	}
+	return s
+}
+
+func (e *Engine) Init(ctx context.Context) (dbgp.InitResponse, error) {
+	e.record("Init")
+	return e.Info, nil
+}
+
+func (e *Engine) Status(ctx context.Context) (string, error) {
+	e.record("Status")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case !e.started:
+		return "starting", nil
+	case e.stop() == nil:
+		return "stopping", nil
+	}
+	return statusOf(e.stop()), nil
+}
+
+func (e *Engine) Features() dbgp.Features {
+	return dbgp.Features{Language_name: e.Language}
+}
+
+func (e *Engine) StepInto(ctx context.Context) (status, reason string, err error) {
+	e.record("StepInto")
+	return e.advance(ctx)
+}
+
+func (e *Engine) StepOver(ctx context.Context) (status, reason string, err error) {
+	e.record("StepOver")
+	return e.advance(ctx)
+}
+
+func (e *Engine) Run(ctx context.Context) (status, reason string, err error) {
+	e.record("Run")
+	return e.advance(ctx)
+}
+
+func (e *Engine) StepIntoInstruction(ctx context.Context) (status, reason string, err error) {
+	e.record("StepIntoInstruction")
+	return e.advance(ctx)
+}
+
+func (e *Engine) StepOverInstruction(ctx context.Context) (status, reason string, err error) {
+	e.record("StepOverInstruction")
+	return e.advance(ctx)
+}
+
+func (e *Engine) Disassemble(ctx context.Context, function string) ([]dbgp.Instruction, error) {
+	e.record("Disassemble")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if instructions, ok := e.Instructions[function]; ok {
+		return instructions, nil
+	}
+	return nil, fmt.Errorf("no such function: %s", function)
+}
+
+// StepIntoBack goes back to the previous stop, as do the other backwards
+// continuations. The first stop is the beginning of the history.
+func (e *Engine) StepIntoBack(ctx context.Context) (status, reason string, err error) {
+	e.record("StepIntoBack")
+	return e.retreat(ctx)
+}
+
+func (e *Engine) StepOverBack(ctx context.Context) (status, reason string, err error) {
+	e.record("StepOverBack")
+	return e.retreat(ctx)
+}
+
+func (e *Engine) StepOutBack(ctx context.Context) (status, reason string, err error) {
+	e.record("StepOutBack")
+	return e.retreat(ctx)
+}
+
+func (e *Engine) RunBack(ctx context.Context) (status, reason string, err error) {
+	e.record("RunBack")
+	return e.retreat(ctx)
+}
+
+func (e *Engine) advance(ctx context.Context) (status, reason string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.started = true
+	if e.current < len(e.Stops) {
+		e.current++
+	}
+	return e.stopped()
+}
+
+func (e *Engine) retreat(ctx context.Context) (status, reason string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.started {
+		return "", "", fmt.Errorf("the program is not running")
+	}
+	if e.current > 0 {
+		e.current--
+	}
+	return e.stopped()
+}
+
+// stopped reports the current stop as outcome of a continuation
+func (e *Engine) stopped() (status, reason string, err error) {
+	s := e.stop()
+	if s == nil {
+		return "stopping", "ok", nil
+	}
+	e.notes = append(e.notes, s.Notifications...)
+	if s.Err != nil {
+		return "", "", s.Err
+	}
+	reason = s.Reason
+	if reason == "" {
+		reason = "ok"
+	}
+	return statusOf(s), reason, nil
+}
+
+func (e *Engine) LastStop() *dbgp.Message {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s := e.stop(); s != nil {
+		return s.Message
+	}
+	return nil
+}
+
+func statusOf(s *Stop) string {
+	if s.Status == "" {
+		return "break"
+	}
+	return s.Status
+}
+
+func (e *Engine) StackDepth(ctx context.Context) (int, error) {
+	e.record("StackDepth")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s := e.stop(); s != nil {
+		return len(s.Stack), nil
+	}
+	return 0, nil
+}
+
+func (e *Engine) StackGet(ctx context.Context, depth int) ([]dbgp.Stack, error) {
+	e.record("StackGet")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.stop()
+	if s == nil {
+		return nil, fmt.Errorf("not stopped")
+	}
+	return s.Stack, nil
+}
+
+func (e *Engine) ContextNames(ctx context.Context, depth int) ([]dbgp.Context, error) {
+	e.record("ContextNames")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.stop()
+	if s == nil {
+		return nil, fmt.Errorf("not stopped")
+	}
+	return s.Contexts, nil
+}
+
+func (e *Engine) ContextGet(ctx context.Context, depth, context int) ([]dbgp.Property, error) {
+	e.record("ContextGet")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.stop()
+	if s == nil {
+		return nil, fmt.Errorf("not stopped")
+	}
+	return s.Properties[Scope{depth, context}], nil
+}
+
+func (e *Engine) PropertyGet(ctx context.Context, depth, context int, name string) (dbgp.Property, error) {
+	e.record("PropertyGet")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.stop()
+	if s == nil {
+		return dbgp.Property{}, fmt.Errorf("not stopped")
+	}
+	if p := findProperty(s.Properties[Scope{depth, context}], name); p != nil {
+		return *p, nil
+	}
+	return dbgp.Property{}, fmt.Errorf("no such property: %s", name)
+}
+
+func (e *Engine) PropertySet(ctx context.Context, depth, context int, name, value string) error {
+	e.record("PropertySet")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.stop()
+	if s == nil {
+		return fmt.Errorf("not stopped")
+	}
+	p := findProperty(s.Properties[Scope{depth, context}], name)
+	if p == nil {
+		return fmt.Errorf("no such property: %s", name)
+	}
+	p.Value = value
+	return nil
+}
+
+// findProperty returns a pointer to the property, so it can be changed
+func findProperty(properties []dbgp.Property, fullname string) *dbgp.Property {
+	for i := range properties {
+		p := &properties[i]
+		if p.Fullname == fullname {
+			return p
+		}
+		if strings.HasPrefix(fullname, p.Fullname) {
+			if c := findProperty(p.Children, fullname); c != nil {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Engine) BreakpointSet(ctx context.Context, bpType, fileName string, line int) (dbgp.Breakpoint, error) {
+	e.record("BreakpointSet")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if bpType != "line" {
+		return dbgp.Breakpoint{}, dbgp.ErrUnimplemented
+	}
+	e.lastBpID++
+	bp := dbgp.Breakpoint{ID: e.lastBpID, State: "enabled"}
+	e.breakpoints = append(e.breakpoints, BreakpointRequest{Type: bpType, Filename: fileName, Line: line, Breakpoint: bp})
+	return bp, nil
+}
+
+func (e *Engine) ExceptionBreakpointSet(ctx context.Context, name string) (dbgp.Breakpoint, error) {
+	e.record("ExceptionBreakpointSet")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastBpID++
+	bp := dbgp.Breakpoint{ID: e.lastBpID, State: "enabled"}
+	e.breakpoints = append(e.breakpoints, BreakpointRequest{Type: "exception", Exception: name, Breakpoint: bp})
+	return bp, nil
+}
+
+// WatchpointSet sets a watch breakpoint, which is reported as hardware one
+func (e *Engine) WatchpointSet(ctx context.Context, bpType, expression string) (dbgp.Breakpoint, error) {
+	e.record("WatchpointSet")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastBpID++
+	bp := dbgp.Breakpoint{ID: e.lastBpID, State: "enabled", Hardware: true}
+	e.breakpoints = append(e.breakpoints, BreakpointRequest{Type: bpType, Expression: expression, Breakpoint: bp})
+	return bp, nil
+}
+
+// BreakpointRemove removes a breakpoint from those Breakpoints returns
+func (e *Engine) BreakpointRemove(ctx context.Context, id int) error {
+	e.record("BreakpointRemove")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, r := range e.breakpoints {
+		if r.Breakpoint.ID == id {
+			e.breakpoints = append(e.breakpoints[:i], e.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return dbgp.ErrNoBreakpoint
+}
+
+func (e *Engine) Notifications() []dbgp.Notification {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	notes := e.notes
+	e.notes = nil
+	return notes
+}
+
+func (e *Engine) ReadMemory(ctx context.Context, address uint64, size int) ([]byte, error) {
+	e.record("ReadMemory")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for start, b := range e.Memory {
+		if address >= start && address+uint64(size) <= start+uint64(len(b)) {
+			return b[address-start : address-start+uint64(size)], nil
+		}
+	}
+	return nil, fmt.Errorf("cannot access memory at address 0x%x", address)
+}
+
+func (e *Engine) Source(ctx context.Context, fileName string) ([]byte, error) {
+	e.record("Source")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if src, ok := e.Sources[fileName]; ok {
+		return []byte(src), nil
+	}
+	return nil, fmt.Errorf("no such file: %s", fileName)
+}
+
+func (e *Engine) RedirectStream(ctx context.Context, stream string, mode int, w io.Writer) error {
+	e.record("RedirectStream")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.streams == nil {
+		e.streams = make(map[string]io.Writer)
+	}
+	if mode == 0 {
+		delete(e.streams, stream)
+	} else {
+		e.streams[stream] = w
+	}
+	return nil
+}
+
+// Output writes output of the program to a redirected stream ("stdout" or
+// "stderr"), doing nothing unless the IDE redirected it
+func (e *Engine) Output(stream, data string) error {
+	e.mu.Lock()
+	w := e.streams[stream]
+	e.mu.Unlock()
+	if w == nil {
+		return nil
+	}
+	_, err := io.WriteString(w, data)
+	return err
+}
@@ -0,0 +1,49 @@
+package dbgptest
+
+import (
+	"github.com/traviscline/dbgp"
+	"net"
+	"testing"
+)
+
+func newEngine() *Engine {
+	return NewEngine(Stop{
+		Stack: []dbgp.Stack{{Level: 0, Type: "file", Filename: "/src/main.c", Lineno: 3, Where: "main"}},
+		Properties: map[Scope][]dbgp.Property{
+			{Depth: 0, Context: 0}: {{
+				Name: "p", Fullname: "p", Type: "pt", HasChildren: true, NumChildren: 1,
+				Children: []dbgp.Property{{Name: "x", Fullname: "p.x", Type: "int", Value: "1"}},
+			}},
+		},
+	})
+}
+
+func TestConformance(t *testing.T) {
+	Conformance(t, func(t *testing.T) dbgp.DBGPClient {
+		return newEngine()
+	})
+}
+
+// TestRemoteConformance runs the suite through a dbgp.Remote speaking to the
+// engine over a pipe
+func TestRemoteConformance(t *testing.T) {
+	Conformance(t, func(t *testing.T) dbgp.DBGPClient {
+		ideSide, engineSide := net.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- dbgp.NewConn(engineSide, newEngine()).Run()
+			engineSide.Close()
+		}()
+		t.Cleanup(func() {
+			ideSide.Close()
+			if err := <-done; err != nil {
+				t.Error("engine conn:", err)
+			}
+		})
+		r, err := dbgp.NewRemote(ideSide)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	})
+}
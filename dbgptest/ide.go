@@ -0,0 +1,146 @@
+package dbgptest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/wire"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timeout bounds how long the IDE waits for a packet
+var Timeout = 10 * time.Second
+
+// Response is a decoded response packet
+type Response struct {
+	XMLName xml.Name
+	Raw     []byte     `xml:"-"`
+	Attrs   []xml.Attr `xml:"-"` // all attributes
+
+	Command       string `xml:"command,attr"`
+	TransactionID string `xml:"transaction_id,attr"`
+	Status        string `xml:"status,attr"`
+	Reason        string `xml:"reason,attr"`
+
+	Error      *wire.Error     `xml:"error"`
+	Stack      []dbgp.Stack    `xml:"stack"`
+	Contexts   []dbgp.Context  `xml:"context"`
+	Properties []dbgp.Property `xml:"property"`
+	Text       string          `xml:",chardata"`
+}
+
+// Attr returns the value of the named attribute and whether it is present
+func (r *Response) Attr(name string) (string, bool) {
+	for _, a := range r.Attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// IDE simulates the IDE end of a DBGP connection to a dbgp.Conn running in
+// the same process
+type IDE struct {
+	Init *wire.Init
+
+	conn net.Conn
+	f    *wire.Framer
+	txID int
+	done chan error
+}
+
+// NewIDE connects an IDE to a new dbgp.Conn for client over an in-memory pipe
+// and reads the init packet. setup may configure the Conn before it runs.
+func NewIDE(client dbgp.DBGPClient, setup ...func(*dbgp.Conn)) (*IDE, error) {
+	ideSide, engineSide := net.Pipe()
+	c := dbgp.NewConn(engineSide, client)
+	for _, s := range setup {
+		s(c)
+	}
+	ide := &IDE{
+		conn: ideSide,
+		f:    wire.NewFramer(ideSide),
+		done: make(chan error, 1),
+	}
+	go func() {
+		ide.done <- c.Run()
+		engineSide.Close()
+	}()
+
+	m, err := ide.ReadMessage()
+	if err != nil {
+		ide.Close()
+		return nil, err
+	}
+	init, ok := m.(*wire.Init)
+	if !ok {
+		ide.Close()
+		return nil, fmt.Errorf("expected init packet, got %q", m.Packet())
+	}
+	ide.Init = init
+	return ide, nil
+}
+
+// Command sends a command with the next transaction id and returns its
+// response. args are appended as given, e.g. "-d", "0".
+func (ide *IDE) Command(name string, args ...string) (*Response, error) {
+	ide.txID++
+	line := name + " -i " + strconv.Itoa(ide.txID)
+	if len(args) > 0 {
+		line += " " + strings.Join(args, " ")
+	}
+	return ide.Send(line)
+}
+
+// Send sends a raw command line, without the trailing NUL, and returns the
+// next response
+func (ide *IDE) Send(line string) (*Response, error) {
+	if err := ide.Write([]byte(line + "\x00")); err != nil {
+		return nil, err
+	}
+	for {
+		m, err := ide.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		r, ok := m.(*wire.Response)
+		if !ok {
+			// stream or notify packet
+			continue
+		}
+		resp := &Response{Raw: r.Packet()}
+		if err := xml.Unmarshal(resp.Raw, resp); err != nil {
+			return nil, fmt.Errorf("decoding response %q: %v", resp.Raw, err)
+		}
+		resp.Attrs = r.Attrs
+		return resp, nil
+	}
+}
+
+// Write writes raw bytes to the engine
+func (ide *IDE) Write(b []byte) error {
+	ide.conn.SetWriteDeadline(time.Now().Add(Timeout))
+	_, err := ide.conn.Write(b)
+	return err
+}
+
+// ReadMessage reads and decodes the next packet
+func (ide *IDE) ReadMessage() (wire.Message, error) {
+	ide.conn.SetReadDeadline(time.Now().Add(Timeout))
+	return ide.f.ReadMessage()
+}
+
+// Close closes the connection and waits for the Conn to return
+func (ide *IDE) Close() error {
+	ide.conn.Close()
+	select {
+	case err := <-ide.done:
+		return err
+	case <-time.After(Timeout):
+		return fmt.Errorf("conn did not stop")
+	}
+}
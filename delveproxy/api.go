@@ -0,0 +1,176 @@
+package delveproxy
+
+// Subset of Delve's JSON-RPC API (service/api and service/rpc2), mirrored here
+// so the package only depends on the wire format.
+
+import "reflect"
+
+type location struct {
+	PC       uint64    `json:"pc"`
+	File     string    `json:"file"`
+	Line     int       `json:"line"`
+	Function *function `json:"function,omitempty"`
+}
+
+type function struct {
+	Name string `json:"name"`
+}
+
+type stackframe struct {
+	location
+	FrameOffset int64
+	Err         string
+}
+
+type thread struct {
+	ID          int       `json:"id"`
+	PC          uint64    `json:"pc"`
+	File        string    `json:"file"`
+	Line        int       `json:"line"`
+	Function    *function `json:"function,omitempty"`
+	GoroutineID int64     `json:"goroutineID"`
+
+	Breakpoint *breakpoint `json:"breakPoint,omitempty"` // the thread stopped at, if any
+}
+
+type goroutine struct {
+	ID             int64    `json:"id"`
+	CurrentLoc     location `json:"currentLoc"`
+	UserCurrentLoc location `json:"userCurrentLoc"`
+	ThreadID       int      `json:"threadID"`
+}
+
+type debuggerState struct {
+	Running           bool
+	CurrentThread     *thread    `json:"currentThread,omitempty"`
+	SelectedGoroutine *goroutine `json:"currentGoroutine,omitempty"`
+	Exited            bool       `json:"exited"`
+	ExitStatus        int        `json:"exitStatus"`
+}
+
+type debuggerCommand struct {
+	Name        string `json:"name"`
+	GoroutineID int64  `json:"goroutineID,omitempty"`
+}
+
+type breakpoint struct {
+	ID           int    `json:"id"`
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+	FunctionName string `json:"functionName,omitempty"`
+}
+
+type variable struct {
+	Name       string       `json:"name"`
+	Addr       uint64       `json:"addr"`
+	Type       string       `json:"type"`
+	RealType   string       `json:"realType"`
+	Kind       reflect.Kind `json:"kind"`
+	Value      string       `json:"value"`
+	Len        int64        `json:"len"`
+	Cap        int64        `json:"cap"`
+	Children   []variable   `json:"children"`
+	Unreadable string       `json:"unreadable"`
+}
+
+type evalScope struct {
+	GoroutineID  int64
+	Frame        int
+	DeferredCall int
+}
+
+type loadConfig struct {
+	FollowPointers     bool
+	MaxVariableRecurse int
+	MaxStringLen       int
+	MaxArrayValues     int
+	MaxStructFields    int
+}
+
+type commandOut struct {
+	State debuggerState
+}
+
+type stateIn struct {
+	NonBlocking bool
+}
+
+type stateOut struct {
+	State *debuggerState
+}
+
+type stacktraceIn struct {
+	Id    int64
+	Depth int
+	Full  bool
+	Cfg   *loadConfig
+}
+
+type stacktraceOut struct {
+	Locations []stackframe
+}
+
+type listVarsIn struct {
+	Scope evalScope
+	Cfg   loadConfig
+}
+
+type listLocalVarsOut struct {
+	Variables []variable
+}
+
+type listFunctionArgsOut struct {
+	Args []variable
+}
+
+type listPackageVarsIn struct {
+	Filter string
+	Cfg    loadConfig
+}
+
+type listPackageVarsOut struct {
+	Variables []variable
+}
+
+type evalIn struct {
+	Scope evalScope
+	Expr  string
+	Cfg   *loadConfig
+}
+
+type evalOut struct {
+	Variable *variable
+}
+
+type createBreakpointIn struct {
+	Breakpoint breakpoint
+}
+
+type createBreakpointOut struct {
+	Breakpoint breakpoint
+}
+
+type findLocationIn struct {
+	Scope evalScope
+	Loc   string
+}
+
+type findLocationOut struct {
+	Locations []location
+}
+
+type listGoroutinesIn struct {
+	Start int
+	Count int
+}
+
+type listGoroutinesOut struct {
+	Goroutines []*goroutine
+	Nextg      int
+}
+
+type detachIn struct {
+	Kill bool
+}
+
+type detachOut struct{}
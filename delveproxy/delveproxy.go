@@ -0,0 +1,493 @@
+// Package delveproxy implements a dbgp.DBGPClient that is backed by a headless
+// Delve session, speaking Delve's JSON-RPC API
+package delveproxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/internal/launch"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// how long to wait for dlv to start listening
+var startTimeout = 30 * time.Second
+
+// configurations for loading variables in a context and for a single property
+var (
+	contextLoadConfig  = loadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 256, MaxArrayValues: 64, MaxStructFields: -1}
+	propertyLoadConfig = loadConfig{FollowPointers: true, MaxVariableRecurse: 2, MaxStringLen: 1024, MaxArrayValues: 256, MaxStructFields: -1}
+)
+
+// Contexts exposed by the Delve proxy
+const (
+	ContextLocals = iota
+	ContextArguments
+	ContextGlobals
+)
+
+// Delve implements the dbgp.DBGPClient protocol and manages an execution of dlv
+type Delve struct {
+	status          string // ("starting", "stopping", "running", "break")
+	ideKey, session string
+	features        dbgp.Features
+
+	cmd *exec.Cmd
+	rpc *rpc.Client
+
+	goroutine int64 // selected goroutine, -1 for the current one
+	lastStop  *dbgp.Message
+}
+
+// Option configures how the debugged program is started
+type Option = launch.Option
+
+// Options of how the debugged program is started
+var (
+	// WithArgs sets the arguments passed to the target program
+	WithArgs = launch.WithArgs
+	// WithEnv sets environment variables ("KEY=VAL") for the target program
+	WithEnv = launch.WithEnv
+	// WithDir sets the working directory of the target program
+	WithDir = launch.WithDir
+	// WithStdio redirects the target program's stdin, stdout and stderr to
+	// the named files. Empty names are left untouched.
+	WithStdio = launch.WithStdio
+)
+
+// New creates a new Delve DBGP Proxy for the specified target binary
+func New(target, ideKey, session string, opts ...Option) (*Delve, error) {
+	o := launch.Apply(opts...)
+	if err := o.Check(); err != nil {
+		return nil, err
+	}
+
+	args := []string{"exec", target, "--headless", "--api-version=2", "--listen=127.0.0.1:0"}
+	if o.Dir != "" {
+		args = append(args, "--wd", o.Dir)
+	}
+	for _, r := range []struct{ name, file string }{{"stdin", o.Stdin}, {"stdout", o.Stdout}, {"stderr", o.Stderr}} {
+		if r.file != "" {
+			args = append(args, "-r", r.name+":"+r.file)
+		}
+	}
+	args = append(args, "--")
+	args = append(args, o.Args...)
+
+	cmd := exec.Command("dlv", args...)
+	cmd.Env = append(os.Environ(), o.Env...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	addr, err := listenAddr(stdout, startTimeout)
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, err
+	}
+	client, err := jsonrpc.Dial("tcp", addr)
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, err
+	}
+	return &Delve{
+		status:    "starting",
+		ideKey:    ideKey,
+		session:   session,
+		features:  dbgp.Features{Language_name: "go"},
+		cmd:       cmd,
+		rpc:       client,
+		goroutine: -1,
+	}, nil
+}
+
+// Init is invoked to begin the session with the upstream IDE or proxy
+func (d *Delve) Init(ctx context.Context) (dbgp.InitResponse, error) {
+	var fileName string
+	var out findLocationOut
+	if err := d.call(ctx, "FindLocation", findLocationIn{Scope: d.scope(0), Loc: "main.main"}, &out); err != nil {
+		if ctx.Err() != nil {
+			return dbgp.InitResponse{}, err
+		}
+		glog.Warningln("[delveproxy] could not find main.main:", err)
+	} else if len(out.Locations) > 0 {
+		fileName = out.Locations[0].File
+	}
+	return dbgp.InitResponse{
+		AppID:    "delveproxy",
+		IDeKey:   d.ideKey,
+		Session:  d.session,
+		Thread:   "1",
+		Language: "go",
+		FileURI:  fileName,
+	}, nil
+}
+
+func (d *Delve) Status(ctx context.Context) (string, error) {
+	return d.status, nil
+}
+
+func (d *Delve) Features() dbgp.Features {
+	return d.features
+}
+
+// runs to main.main
+func (d *Delve) start(ctx context.Context) (status, reason string, err error) {
+	var out createBreakpointOut
+	if err := d.call(ctx, "CreateBreakpoint", createBreakpointIn{breakpoint{FunctionName: "main.main"}}, &out); err != nil {
+		return "", "", err
+	}
+	return d.command(ctx, "continue")
+}
+
+func (d *Delve) StepInto(ctx context.Context) (status, reason string, err error) {
+	if d.status == "starting" {
+		return d.start(ctx)
+	}
+	return d.command(ctx, "step")
+}
+
+func (d *Delve) StepOver(ctx context.Context) (status, reason string, err error) {
+	if d.status == "starting" {
+		return d.start(ctx)
+	}
+	return d.command(ctx, "next")
+}
+
+func (d *Delve) Run(ctx context.Context) (status, reason string, err error) {
+	return d.command(ctx, "continue")
+}
+
+// issues an execution command, updating the status from the resulting state
+func (d *Delve) command(ctx context.Context, name string) (status, reason string, err error) {
+	var out commandOut
+	if err := d.call(ctx, "Command", debuggerCommand{Name: name}, &out); err != nil {
+		return "", "", err
+	}
+	switch {
+	case out.State.Exited:
+		d.status = "stopping"
+	case out.State.Running:
+		d.status = "running"
+	default:
+		d.status = "break"
+	}
+	d.lastStop = stopOf(out.State)
+	return d.status, "ok", nil
+}
+
+// LastStop describes why the program stopped after the last continuation
+func (d *Delve) LastStop() *dbgp.Message {
+	return d.lastStop
+}
+
+// describes the stop of state, nil if the program is running
+func stopOf(state debuggerState) *dbgp.Message {
+	switch {
+	case state.Exited:
+		code := state.ExitStatus
+		return &dbgp.Message{ExitCode: &code}
+	case state.Running || state.CurrentThread == nil:
+		return nil
+	}
+	t := state.CurrentThread
+	m := &dbgp.Message{Filename: t.File, Lineno: t.Line}
+	if t.Breakpoint != nil {
+		m.BreakpointID = t.Breakpoint.ID
+	}
+	return m
+}
+
+func (d *Delve) StackDepth(ctx context.Context) (int, error) {
+	frames, err := d.stacktrace(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(frames), nil
+}
+
+func (d *Delve) StackGet(ctx context.Context, depth int) ([]dbgp.Stack, error) {
+	frames, err := d.stacktrace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stack := make([]dbgp.Stack, len(frames))
+	for i, f := range frames {
+		where := "?"
+		if f.Function != nil {
+			where = f.Function.Name
+		}
+		stack[i] = dbgp.Stack{
+			Level:    i,
+			Type:     "file",
+			Filename: f.File,
+			Lineno:   f.Line,
+			Where:    where,
+		}
+	}
+	return stack, nil
+}
+
+func (d *Delve) stacktrace(ctx context.Context) ([]stackframe, error) {
+	var out stacktraceOut
+	err := d.call(ctx, "Stacktrace", stacktraceIn{Id: d.goroutine, Depth: 50}, &out)
+	return out.Locations, err
+}
+
+func (d *Delve) ContextNames(ctx context.Context, depth int) ([]dbgp.Context, error) {
+	return []dbgp.Context{
+		{Name: "Locals", ID: ContextLocals},
+		{Name: "Arguments", ID: ContextArguments},
+		{Name: "Globals", ID: ContextGlobals},
+	}, nil
+}
+
+func (d *Delve) ContextGet(ctx context.Context, depth, context int) ([]dbgp.Property, error) {
+	var vars []variable
+	switch context {
+	case ContextLocals:
+		var out listLocalVarsOut
+		if err := d.call(ctx, "ListLocalVars", listVarsIn{d.scope(depth), contextLoadConfig}, &out); err != nil {
+			return nil, err
+		}
+		vars = out.Variables
+	case ContextArguments:
+		var out listFunctionArgsOut
+		if err := d.call(ctx, "ListFunctionArgs", listVarsIn{d.scope(depth), contextLoadConfig}, &out); err != nil {
+			return nil, err
+		}
+		vars = out.Args
+	case ContextGlobals:
+		var out listPackageVarsOut
+		if err := d.call(ctx, "ListPackageVars", listPackageVarsIn{`^main\.`, contextLoadConfig}, &out); err != nil {
+			return nil, err
+		}
+		vars = out.Variables
+	default:
+		return nil, dbgp.ErrInvalidOpts
+	}
+
+	properties := make([]dbgp.Property, len(vars))
+	for i, v := range vars {
+		properties[i] = toProperty(v, v.Name, v.Name)
+	}
+	return properties, nil
+}
+
+func (d *Delve) PropertyGet(ctx context.Context, depth, context int, name string) (dbgp.Property, error) {
+	cfg := propertyLoadConfig
+	var out evalOut
+	if err := d.call(ctx, "Eval", evalIn{Scope: d.scope(depth), Expr: name, Cfg: &cfg}, &out); err != nil {
+		return dbgp.Property{}, err
+	}
+	if out.Variable == nil {
+		return dbgp.Property{}, fmt.Errorf("no value for %s", name)
+	}
+	return toProperty(*out.Variable, name, name), nil
+}
+
+func (d *Delve) BreakpointSet(ctx context.Context, bpType, fileName string, lineNumber int) (dbgp.Breakpoint, error) {
+	if bpType != "line" {
+		return dbgp.Breakpoint{}, fmt.Errorf("only line breakpoints are supported.")
+	}
+	var out createBreakpointOut
+	if err := d.call(ctx, "CreateBreakpoint", createBreakpointIn{breakpoint{File: fileName, Line: lineNumber}}, &out); err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	return dbgp.Breakpoint{ID: out.Breakpoint.ID, State: "enabled"}, nil
+}
+
+// Threads lists the goroutines of the program
+func (d *Delve) Threads(ctx context.Context) ([]dbgp.Thread, error) {
+	var state stateOut
+	if err := d.call(ctx, "State", stateIn{NonBlocking: true}, &state); err != nil {
+		return nil, err
+	}
+	current := d.goroutine
+	if current < 0 && state.State != nil && state.State.SelectedGoroutine != nil {
+		current = state.State.SelectedGoroutine.ID
+	}
+
+	var out listGoroutinesOut
+	if err := d.call(ctx, "ListGoroutines", listGoroutinesIn{}, &out); err != nil {
+		return nil, err
+	}
+	threads := make([]dbgp.Thread, 0, len(out.Goroutines))
+	for _, g := range out.Goroutines {
+		name := fmt.Sprintf("goroutine %d", g.ID)
+		if f := g.UserCurrentLoc.Function; f != nil {
+			name += " " + f.Name
+		}
+		threads = append(threads, dbgp.Thread{
+			ID:      int(g.ID),
+			Name:    name,
+			Current: dbgp.Bool(g.ID == current),
+		})
+	}
+	return threads, nil
+}
+
+// SelectThread switches to the goroutine with the given id, subsequent stack
+// and context requests operate on it
+func (d *Delve) SelectThread(ctx context.Context, id int) error {
+	var out commandOut
+	if err := d.call(ctx, "Command", debuggerCommand{Name: "switchGoroutine", GoroutineID: int64(id)}, &out); err != nil {
+		return err
+	}
+	d.goroutine = int64(id)
+	return nil
+}
+
+// Close detaches from and kills the debugged program
+func (d *Delve) Close() error {
+	err := d.call(context.Background(), "Detach", detachIn{Kill: true}, &detachOut{})
+	d.rpc.Close()
+	d.cmd.Wait()
+	return err
+}
+
+func (d *Delve) scope(frame int) evalScope {
+	return evalScope{GoroutineID: d.goroutine, Frame: frame}
+}
+
+// call invokes a method of Delve's API. When ctx is done first, a running
+// program is halted and ctx's error returned. reply is only written once the
+// call succeeded, an abandoned call decodes into a copy of its own.
+func (d *Delve) call(ctx context.Context, method string, args, reply interface{}) error {
+	glog.V(2).Infoln("[delveproxy]", method, args)
+	out := reflect.New(reflect.TypeOf(reply).Elem())
+	c := d.rpc.Go("RPCServer."+method, args, out.Interface(), nil)
+	select {
+	case <-c.Done:
+		if c.Error == nil {
+			reflect.ValueOf(reply).Elem().Set(out.Elem())
+		}
+		return c.Error
+	case <-ctx.Done():
+	}
+	if method == "Command" {
+		// the pending command returns once the program stopped
+		d.rpc.Go("RPCServer.Command", debuggerCommand{Name: "halt"}, &commandOut{}, nil)
+		<-c.Done
+	}
+	return ctx.Err()
+}
+
+// toProperty converts a Delve variable into a property, expanding Go
+// composite types into children
+func toProperty(v variable, name, fullname string) dbgp.Property {
+	p := dbgp.Property{
+		Name:     name,
+		Fullname: fullname,
+		Type:     v.Type,
+		Value:    v.Value,
+	}
+	if v.Addr != 0 {
+		p.Address = fmt.Sprintf("0x%x", v.Addr)
+	}
+	if v.Unreadable != "" {
+		p.Value = "(unreadable " + v.Unreadable + ")"
+		return p
+	}
+
+	switch v.Kind {
+	case reflect.Slice, reflect.Array:
+		p.NumChildren = int(v.Len)
+		for i, c := range v.Children {
+			idx := fmt.Sprintf("[%d]", i)
+			p.Children = append(p.Children, toProperty(c, idx, fullname+idx))
+		}
+		if v.Kind == reflect.Slice {
+			p.Value = fmt.Sprintf("len: %d, cap: %d", v.Len, v.Cap)
+		}
+	case reflect.Map:
+		// children alternate between keys and values
+		p.NumChildren = int(v.Len)
+		for i := 0; i+1 < len(v.Children); i += 2 {
+			key := "[" + keyString(v.Children[i]) + "]"
+			p.Children = append(p.Children, toProperty(v.Children[i+1], key, fullname+key))
+		}
+		p.Value = fmt.Sprintf("len: %d", v.Len)
+	case reflect.Struct:
+		p.NumChildren = len(v.Children)
+		for _, c := range v.Children {
+			p.Children = append(p.Children, toProperty(c, c.Name, fullname+"."+c.Name))
+		}
+	case reflect.Ptr:
+		if len(v.Children) == 1 && v.Children[0].Addr != 0 {
+			p.NumChildren = 1
+			p.Children = []dbgp.Property{toProperty(v.Children[0], "*"+name, "(*"+fullname+")")}
+		}
+	case reflect.Interface:
+		// show the dynamic value in place of the interface
+		if len(v.Children) == 1 {
+			c := toProperty(v.Children[0], name, fullname+".("+v.Children[0].Type+")")
+			c.Type = v.Type
+			c.Classname = v.Children[0].Type
+			return c
+		}
+		p.Value = "nil"
+	case reflect.Chan:
+		p.Value = fmt.Sprintf("len: %d, cap: %d", v.Len, v.Cap)
+		p.NumChildren = len(v.Children)
+		for _, c := range v.Children {
+			p.Children = append(p.Children, toProperty(c, c.Name, fullname+"."+c.Name))
+		}
+	case reflect.String:
+		p.Size = int(v.Len)
+	}
+	p.HasChildren = p.NumChildren > 0
+	return p
+}
+
+// keyString renders a map key for use in a property name
+func keyString(v variable) string {
+	if v.Kind == reflect.String {
+		return fmt.Sprintf("%q", v.Value)
+	}
+	if v.Value == "" {
+		return v.Type
+	}
+	return v.Value
+}
+
+// listenAddr scans dlv's output for the address of the API server, then keeps
+// forwarding the program's output to the log
+func listenAddr(r io.Reader, timeout time.Duration) (string, error) {
+	const prefix = "API server listening at: "
+	addrChan := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, prefix) {
+				addrChan <- strings.TrimSpace(strings.TrimPrefix(line, prefix))
+				continue
+			}
+			glog.V(1).Infoln("(dlv) ", line)
+		}
+		close(addrChan)
+	}()
+	select {
+	case addr, ok := <-addrChan:
+		if !ok {
+			return "", fmt.Errorf("dlv exited before listening")
+		}
+		return addr, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("timed out waiting for dlv to listen")
+	}
+}
@@ -0,0 +1,47 @@
+package delveproxy
+
+import (
+	"encoding/json"
+	"github.com/traviscline/dbgp"
+	"reflect"
+	"testing"
+)
+
+func TestStopOf(t *testing.T) {
+	zero := 0
+	tests := []struct {
+		name  string
+		state string // as Delve sends it
+		msg   *dbgp.Message
+	}{
+		{
+			"breakpoint",
+			`{"Running":false,"currentThread":{"id":1,"file":"/src/main.go","line":7,"goroutineID":1,"breakPoint":{"id":2,"file":"/src/main.go","line":7}},"exited":false}`,
+			&dbgp.Message{Filename: "/src/main.go", Lineno: 7, BreakpointID: 2},
+		},
+		{
+			"step",
+			`{"Running":false,"currentThread":{"id":1,"file":"/src/main.go","line":8,"goroutineID":1},"exited":false}`,
+			&dbgp.Message{Filename: "/src/main.go", Lineno: 8},
+		},
+		{
+			"running",
+			`{"Running":true,"exited":false}`,
+			nil,
+		},
+		{
+			"exited",
+			`{"Running":false,"exited":true,"exitStatus":0}`,
+			&dbgp.Message{ExitCode: &zero},
+		},
+	}
+	for _, tt := range tests {
+		var state debuggerState
+		if err := json.Unmarshal([]byte(tt.state), &state); err != nil {
+			t.Fatal(err)
+		}
+		if msg := stopOf(state); !reflect.DeepEqual(msg, tt.msg) {
+			t.Errorf("%s: got message %+v, want %+v", tt.name, msg, tt.msg)
+		}
+	}
+}
@@ -18,4 +18,14 @@ var (
 	ErrInvalidOpts = dbgpError{3, "Invaild Options"}
 	// ErrUnimplemented means the attempted action is not implemented
 	ErrUnimplemented = dbgpError{4, "Unimplemented"}
+	// ErrAuthRequired means the IDE has to authenticate first
+	ErrAuthRequired = dbgpError{5, "Authentication required"}
+	// ErrAuthFailed means the authentication response was wrong
+	ErrAuthFailed = dbgpError{5, "Authentication failed"}
+	// ErrBreakpointType means the breakpoint type is not supported
+	ErrBreakpointType = dbgpError{201, "Breakpoint type not supported"}
+	// ErrNoBreakpoint means there is no breakpoint with the given id
+	ErrNoBreakpoint = dbgpError{205, "No such breakpoint"}
+	// ErrCantOpenFile means a file could not be opened
+	ErrCantOpenFile = dbgpError{100, "Can not open file"}
 )
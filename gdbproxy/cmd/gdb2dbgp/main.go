@@ -1,6 +1,7 @@
 // Program dbgp2dbg implements a dbgp to gdb proxy
 //
-// dbg2dbg (gdb target)
+// dbg2dbg [flags] [--] (gdb target) [target args...]
+// dbg2dbg -rr [flags] [trace dir]
 //
 // note: invoke with the following options to debug: -v=2 -logtostderr
 package main
@@ -8,40 +9,101 @@ package main
 import (
 	"flag"
 	"fmt"
-	"github.com/traviscline/dbgp"
 	"github.com/traviscline/dbgp/gdbproxy"
-	"log"
-	"net"
+	"github.com/traviscline/dbgp/internal/cli"
 	"os"
+	"strings"
+	"time"
 )
 
-var dial = flag.String("dial", "localhost:9000", "DBGP host/port to conenct to")
+var engine = cli.EngineFlags(flag.CommandLine)
+var program = cli.LaunchFlags(flag.CommandLine)
+var unsafeEval = flag.Bool("unsafe-eval", false, "let the IDE evaluate arbitrary expressions, which can run code in the target")
+var rr = flag.Bool("rr", false, "replay the rr trace directory given as target (default the latest trace) instead of running a program")
+var reverse = flag.Bool("reverse", false, "record the execution with gdb's record full, so it can be run backwards (slow)")
 var target string
+var timeouts cli.StringList
+var signals cli.StringList
+
+func init() {
+	flag.Var(&timeouts, "timeout", "timeout of a gdb command as command=duration, e.g. info=30s or continue=1m (repeatable)")
+	flag.Var(&signals, "handle", "handling of a signal like gdb's handle command, e.g. \"SIGUSR1 nostop noprint pass\" (repeatable)")
+}
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [--] target [args...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -rr [flags] [trace dir]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
-	if flag.NArg() != 1 {
+	switch {
+	case *rr && flag.NArg() > 1:
+		fmt.Fprintln(os.Stderr, "Arguments are fixed by the rr trace")
+		flag.Usage()
+		os.Exit(1)
+	case !*rr && flag.NArg() < 1:
 		fmt.Fprintln(os.Stderr, "No target specified")
 		flag.Usage()
 		os.Exit(1)
 	}
-	target = flag.Args()[0]
+	var args []string
+	if flag.NArg() > 0 {
+		target, args = flag.Args()[0], flag.Args()[1:]
+	}
+
+	secret, err := engine.Secret()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading secret:", err)
+		os.Exit(1)
+	}
 
-	log.Println("dialing", *dial)
-	c, err := net.Dial("tcp", *dial)
+	c, err := engine.Connect()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error connecting to IDE:", err)
 		os.Exit(1)
 	}
 
 	ideKey, session := os.Getenv("DBGP_IDEKEY"), os.Getenv("DBGP_COOKIE")
-	p, err := gdbproxy.New(target, ideKey, session)
+	opts := []gdbproxy.Option{
+		gdbproxy.WithArgs(args...),
+		gdbproxy.WithEnv(program.Env...),
+		gdbproxy.WithDir(program.Dir),
+		gdbproxy.WithStdio(program.Stdin, program.Stdout, program.Stderr),
+	}
+	if *unsafeEval {
+		opts = append(opts, gdbproxy.WithUnsafeEval())
+	}
+	if *rr {
+		opts = append(opts, gdbproxy.WithReplay())
+	}
+	if *reverse {
+		opts = append(opts, gdbproxy.WithRecord())
+	}
+	for _, t := range timeouts {
+		i := strings.Index(t, "=")
+		d, err := time.ParseDuration(t[i+1:])
+		if i < 0 || err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid timeout %q, expected command=duration\n", t)
+			os.Exit(1)
+		}
+		opts = append(opts, gdbproxy.WithTimeout(t[:i], d))
+	}
+	for _, s := range signals {
+		fields := strings.Fields(s)
+		if len(fields) < 2 {
+			fmt.Fprintf(os.Stderr, "Invalid signal handling %q, expected signal and actions\n", s)
+			os.Exit(1)
+		}
+		opts = append(opts, gdbproxy.WithSignal(fields[0], fields[1:]...))
+	}
+	p, err := gdbproxy.New(target, ideKey, session, opts...)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error creating proxy:", err)
 		os.Exit(1)
 	}
 
-	conn := dbgp.NewConn(c, p)
+	conn := engine.NewConn(c, p, secret)
 	if err := conn.Run(); err != nil {
 		fmt.Fprintln(os.Stderr, "Error running proxy:", err)
 		os.Exit(1)
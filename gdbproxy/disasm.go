@@ -0,0 +1,109 @@
+package gdbproxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"regexp"
+	"strings"
+)
+
+var (
+	// an instruction printed by disassemble or x/i:
+	// => 0x0000555555555131 <+8>:	mov    $0x0,%eax
+	instructionRe = regexp.MustCompile(`^(=>)?\s*(0x[0-9a-f]+)(?: <([^>]*)>)?:\s+(.*)$`)
+	dumpRe        = regexp.MustCompile(`^Dump of assembler code for function (.+):$`)
+	// the innermost frame printed by where, e.g.
+	// #0  0x00007ffff7e1e8b5 in raise () from /lib/libc.so.6
+	frameRe = regexp.MustCompile(`^#0\s+(?:0x[0-9a-f]+ in )?(\S+) \(`)
+	// function names of C, C++ and Go
+	functionRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.:$]*$`)
+)
+
+// disasmLength is the number of instructions shown from the program counter
+// when the current function is unknown
+const disasmLength = 32
+
+// Disassemble disassembles a function, or the current one if empty. Without
+// symbols the instructions following the program counter are returned.
+func (g *GDB) Disassemble(ctx context.Context, function string) ([]dbgp.Instruction, error) {
+	if function != "" && !functionRe.MatchString(function) {
+		return nil, fmt.Errorf("invalid function name %q", function)
+	}
+	lines, err := g.exec(ctx, strings.TrimSpace("disassemble "+function))
+	if err != nil {
+		return nil, err
+	}
+	instructions := parseInstructions(lines)
+	if len(instructions) == 0 && function == "" {
+		if lines, err = g.exec(ctx, fmt.Sprintf("x /%di $pc", disasmLength)); err != nil {
+			return nil, err
+		}
+		instructions = parseInstructions(lines)
+	}
+	if len(instructions) == 0 {
+		return nil, fmt.Errorf("%s", strings.Join(lines, " "))
+	}
+	return instructions, nil
+}
+
+// parseInstructions parses the output of disassemble or x/i
+func parseInstructions(lines []string) []dbgp.Instruction {
+	var (
+		instructions []dbgp.Instruction
+		function     string
+	)
+	for _, l := range lines {
+		if m := dumpRe.FindStringSubmatch(l); m != nil {
+			function = m[1]
+			continue
+		}
+		m := instructionRe.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		symbol := m[3]
+		if strings.HasPrefix(symbol, "+") {
+			// disassemble only prints the offset into the function
+			symbol = function + symbol
+		}
+		instructions = append(instructions, dbgp.Instruction{
+			Address: m[2],
+			Symbol:  symbol,
+			Current: m[1] == "=>",
+			Text:    m[4],
+		})
+	}
+	return instructions
+}
+
+// disasmFrame returns the innermost stack frame if it has no line
+// information, pointing into the disassembly of its function
+func (g *GDB) disasmFrame(ctx context.Context) (dbgp.Stack, bool) {
+	lines, err := g.exec(ctx, "where 1")
+	if err != nil || len(lines) == 0 || locationRe.MatchString(lines[0]) {
+		return dbgp.Stack{}, false
+	}
+	m := frameRe.FindStringSubmatch(lines[0])
+	if m == nil {
+		return dbgp.Stack{}, false
+	}
+	function := m[1]
+	if function == "??" {
+		function = ""
+	}
+	instructions, err := g.Disassemble(ctx, function)
+	if err != nil {
+		return dbgp.Stack{}, false
+	}
+	s := dbgp.Stack{Type: "file", Filename: dbgp.DisasmURIPrefix + function, Where: m[1]}
+	for i, ins := range instructions {
+		if ins.Current {
+			s.Lineno = i + 1
+			s.CmdBegin = fmt.Sprintf("%d:0", s.Lineno)
+			s.CmdEnd = fmt.Sprintf("%d:%d", s.Lineno, len(ins.String()))
+			break
+		}
+	}
+	return s, true
+}
@@ -0,0 +1,151 @@
+package gdbproxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cxxTypeRe matches the C++ type names accepted as filter of catch throw and
+// catch catch, e.g. std::runtime_error or ns::error<int>
+var cxxTypeRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_:<>, ]*$`)
+
+// quotedRe matches a string value printed by gdb, e.g. $1 = 0x4052a0 "boom"
+var quotedRe = regexp.MustCompile(`^\$[0-9]+ = .*?("(?:\\.|[^"\\])*")`)
+
+// argRe matches an argument as listed by info args, e.g. e = {_type = ...}
+var argRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*) = `)
+
+// printedRe matches a value printed by gdb
+var printedRe = regexp.MustCompile(`^\$[0-9]+ = (.+)$`)
+
+// catchException stops the program when a C++ exception is thrown or caught,
+// or when a Go program panics. name is "panic" for Go; for C++ it is "throw"
+// or "catch", optionally followed by the exception type, or just the type of
+// the exceptions thrown.
+func (g *GDB) catchException(ctx context.Context, name string) (dbgp.Breakpoint, error) {
+	kind, typ := name, ""
+	if i := strings.IndexByte(name, ' '); i > 0 {
+		kind, typ = name[:i], strings.TrimSpace(name[i+1:])
+	}
+	switch {
+	case kind != "throw" && kind != "catch" && kind != "panic":
+		kind, typ = "throw", name
+	case kind == "panic" && typ != "":
+		return dbgp.Breakpoint{}, fmt.Errorf("panics cannot be caught by type")
+	}
+	if typ != "" && !cxxTypeRe.MatchString(typ) {
+		return dbgp.Breakpoint{}, fmt.Errorf("%q is not a C++ type", typ)
+	}
+
+	var line string
+	switch {
+	case kind == "panic":
+		if _, err := g.exec(ctx, "set breakpoint pending on"); err != nil {
+			return dbgp.Breakpoint{}, err
+		}
+		line = "break runtime.gopanic"
+	case typ != "":
+		// gdb matches a regular expression against the type name
+		line = fmt.Sprintf("catch %s ^%s$", kind, typ)
+	default:
+		line = "catch " + kind
+	}
+	lines, err := g.exec(ctx, line)
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	for _, l := range lines {
+		// Catchpoint 1 (throw) or Breakpoint 1 at 0x432a0: file panic.go, line 700.
+		f := strings.Fields(l)
+		if len(f) > 1 && (f[0] == "Catchpoint" || f[0] == "Breakpoint") {
+			id, err := strconv.Atoi(f[1])
+			if err != nil {
+				return dbgp.Breakpoint{}, err
+			}
+			g.exceptions[id] = kind
+			return dbgp.Breakpoint{ID: id, State: "enabled"}, nil
+		}
+	}
+	return dbgp.Breakpoint{}, fmt.Errorf("%s", strings.Join(lines, " "))
+}
+
+// describeException fills in the type and message of the exception the
+// program stopped for. C++ exceptions are inspected with $_exception, which
+// requires the SystemTap probes of libstdc++. The values of Go panics, the
+// argument of runtime.gopanic, are inspected with $dtype, which requires
+// runtime-gdb.py of the Go runtime, and otherwise printed as they are.
+// Without them the exception is reported as "exception" or "panic".
+func (g *GDB) describeException(ctx context.Context, kind string, msg *dbgp.Message) {
+	var typ, text string
+	if kind == "panic" {
+		typ, text = g.describePanic(ctx)
+	} else {
+		typ = "exception"
+		if t := g.evalString(ctx, "whatis $_exception"); strings.HasPrefix(t, "type = ") {
+			typ = strings.TrimPrefix(t, "type = ")
+		}
+		text = quoted(g.evalString(ctx, "print $_exception.what()"))
+	}
+	msg.Exception = typ
+	msg.Text = typ
+	if text != "" {
+		msg.Text += ": " + text
+	}
+}
+
+// describePanic returns the dynamic type and the value of the panic the
+// program stopped in runtime.gopanic for
+func (g *GDB) describePanic(ctx context.Context) (typ, text string) {
+	// the argument is e in current runtimes, but has been named otherwise
+	arg := "e"
+	if lines, err := g.exec(ctx, "info args"); err == nil {
+		if m := argRe.FindStringSubmatch(firstLine(lines)); m != nil {
+			arg = m[1]
+		}
+	}
+	if t := g.evalString(ctx, "whatis $dtype("+arg+")"); strings.HasPrefix(t, "type = ") {
+		return strings.TrimPrefix(t, "type = "), printed(g.evalString(ctx, "print $dtype("+arg+")"))
+	}
+	// no runtime-gdb.py, the interface as printed
+	return "panic", printed(g.evalString(ctx, "print "+arg))
+}
+
+// evalString returns the first line printed by a gdb command, or "" if it
+// failed
+func (g *GDB) evalString(ctx context.Context, line string) string {
+	lines, err := g.exec(ctx, line)
+	if err != nil {
+		return ""
+	}
+	return firstLine(lines)
+}
+
+// printed returns the value printed by gdb in s, unquoted if it is a string,
+// or "" if s is no value
+func printed(s string) string {
+	if q := quoted(s); q != "" {
+		return q
+	}
+	if m := printedRe.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// quoted returns the string value printed by gdb in s, unquoted, or "" if s
+// is no string value
+func quoted(s string) string {
+	m := quotedRe.FindStringSubmatch(s)
+	if m == nil {
+		return ""
+	}
+	q := m[1]
+	if u, err := strconv.Unquote(q); err == nil {
+		return u
+	}
+	return q[1 : len(q)-1]
+}
@@ -0,0 +1,59 @@
+package gdbproxy
+
+import "testing"
+
+func TestPrinted(t *testing.T) {
+	for _, tt := range []struct{ in, quoted, printed string }{
+		{`$1 = 0x4052a0 "boom"`, "boom", "boom"},
+		{`$2 = "say \"hi\"\n"`, "say \"hi\"\n", "say \"hi\"\n"},
+		{`$3 = 0x4052a0 <std::string> "a\\b"`, `a\b`, `a\b`},
+		{`$4 = 42`, "", "42"},
+		{`$5 = {_type = 0x4a1b20, data = 0xc000010250}`, "", "{_type = 0x4a1b20, data = 0xc000010250}"},
+		{"Invalid data type for function to be called.", "", ""},
+		{`No symbol "e" in current context.`, "", ""},
+		{"", "", ""},
+	} {
+		if got := quoted(tt.in); got != tt.quoted {
+			t.Errorf("quoted(%q) = %q, want %q", tt.in, got, tt.quoted)
+		}
+		if got := printed(tt.in); got != tt.printed {
+			t.Errorf("printed(%q) = %q, want %q", tt.in, got, tt.printed)
+		}
+	}
+}
+
+func TestArgRe(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"e = {_type = 0x4a1b20, data = 0xc000010250}", "e"},
+		{"arg0 = 0x0", "arg0"},
+		{"No arguments.", ""},
+		{"No symbol table info available.", ""},
+	} {
+		got := ""
+		if m := argRe.FindStringSubmatch(tt.in); m != nil {
+			got = m[1]
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCxxTypeRe(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want bool
+	}{
+		{"std::runtime_error", true},
+		{"ns::error<int, char>", true},
+		{"MyError", true},
+		{"", false},
+		{"std::error; shell ls", false},
+		{".*", false},
+		{"1bad", false},
+	} {
+		if got := cxxTypeRe.MatchString(tt.in); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
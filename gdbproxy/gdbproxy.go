@@ -2,38 +2,60 @@
 package gdbproxy
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/traviscline/dbgp"
-	"io"
+	"github.com/traviscline/dbgp/internal/console"
+	"github.com/traviscline/dbgp/internal/launch"
+	"github.com/traviscline/dbgp/internal/policy"
 	"os/exec"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-var defaultWait = 100 * time.Millisecond
-
 // GDB iconnmplements the dbgp.DBGPClient protocol and manages an execution of gdb
 type GDB struct {
 	status          string // ("starting", "stopping", "running", "break")
 	ideKey, session string
 	features        dbgp.Features
 
-	cmd *exec.Cmd
+	con        *console.Console
+	runArgs    string // redirections appended to "run"
+	record     bool   // "record full" at the first stop
+	replay     bool   // replaying an rr trace, which runs with "continue"
+	policy     *policy.Policy
+	unsafeEval bool
+	timeouts   map[string]time.Duration
+
+	lastStop  *dbgp.Message
+	notes     []dbgp.Notification // pending for the IDE
+	logpoints []int               // gdb numbers of the logpoints
+	asString  *bool               // whether gdb has $_as_string, once probed
+	// kinds of the exception breakpoints by gdb number: "throw", "catch"
+	// or "panic"
+	exceptions map[int]string
+}
 
-	stdout, stderr <-chan string
-	stdin          chan<- string
+// DefaultTimeout bounds gdb commands other than those resuming the program,
+// which may run for as long as the program does unless configured with
+// WithTimeout
+var DefaultTimeout = 10 * time.Second
 
-	errChan chan error
+// resuming are the gdb commands that run the program
+var resuming = map[string]bool{
+	"run": true, "continue": true, "step": true, "next": true, "stepi": true, "nexti": true,
+	"reverse-step": true, "reverse-next": true, "reverse-finish": true, "reverse-continue": true,
 }
 
-// Init is invoked to begin the session with the upstream IDE or proxy
-func (g *GDB) Init() dbgp.InitResponse {
-	g.consumeLines(g.stdout, defaultWait)
-	fileName, lang, _ := g.currentFilenameAndLang()
+// Init is invoked to begin the session with the upstream IDE or proxy. A
+// target without debugging information is not an error, its file is empty.
+func (g *GDB) Init(ctx context.Context) (dbgp.InitResponse, error) {
+	fileName, lang, err := g.currentFilenameAndLang(ctx)
+	if err != nil && ctx.Err() != nil {
+		return dbgp.InitResponse{}, err
+	}
 	g.features.Language_name = lang
 
 	return dbgp.InitResponse{
@@ -42,81 +64,207 @@ func (g *GDB) Init() dbgp.InitResponse {
 		Session:  g.session,
 		Thread:   "1",
 		Language: lang,
-		FileURI:  "file://" + fileName,
-	}
+		FileURI:  fileName,
+	}, nil
 }
 
-func (g *GDB) Status() string {
-	return g.status
+func (g *GDB) Status(ctx context.Context) (string, error) {
+	return g.status, nil
 }
 
 func (g *GDB) Features() dbgp.Features {
 	return g.features
 }
 
-func (g *GDB) start() {
-	g.stdin <- "b 1"
-	g.stdin <- "run"
-	g.status = "break"
-	glog.V(1).Infoln("[gdbproxy] start:", g.stdoutLines())
+// exec sends a command line permitted by the policy and returns its output
+// once gdb prompts again. Commands exceeding their timeout or cancelled by
+// ctx are interrupted and return context.DeadlineExceeded or
+// context.Canceled.
+func (g *GDB) exec(ctx context.Context, line string) ([]string, error) {
+	if err := g.policy.Check(line); err != nil {
+		glog.Warningln("[gdbproxy]", err)
+		return nil, err
+	}
+	if d := g.timeout(commandName(line)); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	lines, err := g.con.Command(ctx, line)
+	if err != nil {
+		glog.Warningln("[gdbproxy]", line+":", err)
+	}
+	return lines, err
 }
 
-func (g *GDB) StepInto() (status, reason string) {
-	if g.status == "starting" {
-		g.start()
+// timeout returns the timeout of a gdb command, zero for none
+func (g *GDB) timeout(cmd string) time.Duration {
+	if d, ok := g.timeouts[cmd]; ok {
+		return d
+	}
+	if resuming[cmd] {
+		return 0
 	}
-	g.stdin <- "s"
-	glog.V(2).Infoln("[gdbproxy] StepInto:", g.stdoutLines())
-	return "break", "ok"
+	return DefaultTimeout
 }
 
-func (g *GDB) StepOver() (status, reason string) {
+// LastStop describes why the program stopped after the last continuation
+func (g *GDB) LastStop() *dbgp.Message {
+	return g.lastStop
+}
+
+// resume runs a command resuming the program and updates the status from
+// gdb's stop events. A command stopped by its timeout is reported as
+// aborted, one cancelled by ctx returns ctx's error.
+func (g *GDB) resume(ctx context.Context, line string) (status, reason string, err error) {
+	if g.status == "stopping" {
+		return "", "", fmt.Errorf("the program is not running")
+	}
+	lines, err := g.exec(ctx, line)
+	glog.V(2).Infoln("[gdbproxy]", line+":", lines)
+	if err == nil {
+		if err := refusal(lines); err != nil {
+			return "", "", err
+		}
+	}
+	status, reason, g.lastStop = stopOf(lines)
+	if m := g.lastStop; m != nil && status == "break" && err == nil && g.exceptions[m.BreakpointID] != "" && ctx.Err() == nil {
+		reason = "exception"
+		g.describeException(ctx, g.exceptions[m.BreakpointID], m)
+	}
+	g.notes = append(g.notes, g.logged(lines)...)
+	g.notes = append(g.notes, deletedWatchpoints(lines)...)
+	g.status = status
+	switch {
+	case ctx.Err() != nil:
+		return "", "", ctx.Err()
+	case err == context.DeadlineExceeded || err == context.Canceled:
+		reason = "aborted"
+	case err != nil:
+		return "", "", err
+	}
+	return status, reason, nil
+}
+
+// start runs the program to its first line, where recording begins
+func (g *GDB) start(ctx context.Context) (status, reason string, err error) {
+	if _, err := g.exec(ctx, "b 1"); err != nil {
+		return "", "", err
+	}
+	status, reason, err = g.resume(ctx, g.runLine())
+	if err != nil || !g.record || status != "break" {
+		return
+	}
+	lines, err := g.exec(ctx, "record full")
+	if err == nil && len(lines) > 0 {
+		err = fmt.Errorf("%s", strings.Join(lines, " "))
+	}
+	return status, reason, err
+}
+
+// runLine returns the command starting the program
+func (g *GDB) runLine() string {
+	if g.replay {
+		// rr stopped the replay at the start of the program
+		return "continue"
+	}
+	return strings.TrimSpace("run " + g.runArgs)
+}
+
+func (g *GDB) StepInto(ctx context.Context) (status, reason string, err error) {
+	return g.step(ctx, "s")
+}
+
+func (g *GDB) StepOver(ctx context.Context) (status, reason string, err error) {
+	return g.step(ctx, "n")
+}
+
+// StepIntoInstruction executes one machine instruction
+func (g *GDB) StepIntoInstruction(ctx context.Context) (status, reason string, err error) {
+	return g.step(ctx, "stepi")
+}
+
+// StepOverInstruction executes one machine instruction, stepping over calls
+func (g *GDB) StepOverInstruction(ctx context.Context) (status, reason string, err error) {
+	return g.step(ctx, "nexti")
+}
+
+// step runs a stepping command, starting the program first if needed
+func (g *GDB) step(ctx context.Context, line string) (status, reason string, err error) {
 	if g.status == "starting" {
-		g.start()
+		if status, reason, err = g.start(ctx); err != nil || status != "break" || reason != "ok" {
+			return
+		}
 	}
-	g.stdin <- "n"
-	glog.V(2).Infoln("[gdbproxy] StepOver:", g.stdoutLines())
-	return "break", "ok"
+	return g.resume(ctx, line)
 }
 
-func (g *GDB) StackDepth() int {
-	return 2 // @todo make accurate
+func (g *GDB) Run(ctx context.Context) (status, reason string, err error) {
+	if g.status == "starting" {
+		if !g.record {
+			return g.resume(ctx, g.runLine())
+		}
+		if status, reason, err = g.start(ctx); err != nil || status != "break" || reason != "ok" {
+			return
+		}
+	}
+	return g.resume(ctx, "continue")
 }
 
-func (g *GDB) StackGet(depth int) ([]dbgp.Stack, error) {
-	fn, _, err := g.currentFilenameAndLang()
+// StackDepth counts the frames printed by where
+func (g *GDB) StackDepth(ctx context.Context) (int, error) {
+	lines, err := g.exec(ctx, "where")
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	line, err := g.currentLineNumber()
+	return len(parseStack(lines)), nil
+}
+
+// StackGet returns the frames printed by where, all of them for depth 0 and
+// the one at depth otherwise. The innermost frame points into the
+// disassembly of its function if it has no line information.
+func (g *GDB) StackGet(ctx context.Context, depth int) ([]dbgp.Stack, error) {
+	lines, err := g.exec(ctx, "where")
 	if err != nil {
 		return nil, err
 	}
-	return []dbgp.Stack{
-		{
-			Filename: "file://" + fn,
-			Type:     "file",
-			Lineno:   line,
-			Where:    "{main}",
-		},
-	}, nil
+	stack := parseStack(lines)
+	if len(stack) == 0 {
+		return nil, fmt.Errorf("no stack frames, is the program running?")
+	}
+	if s, ok := g.disasmFrame(ctx); ok {
+		stack[0] = s
+	}
+	switch {
+	case depth == 0:
+		return stack, nil
+	case depth < 0 || depth >= len(stack):
+		return nil, dbgp.ErrInvalidOpts
+	}
+	return stack[depth : depth+1], nil
 }
 
-func (g *GDB) ContextNames(depth int) ([]dbgp.Context, error) {
-	return []dbgp.Context{{"Local", 0}}, nil
+func (g *GDB) ContextNames(ctx context.Context, depth int) ([]dbgp.Context, error) {
+	return []dbgp.Context{{Name: "Local", ID: 0}}, nil
 }
 
-func (g *GDB) ContextGet(depth, context int) ([]dbgp.Property, error) {
+func (g *GDB) ContextGet(ctx context.Context, depth, context int) ([]dbgp.Property, error) {
 	// @todo consider depth, context
-	g.stdin <- "info locals"
-	lines := g.stdoutLines()
-	g.stdin <- "info args"
-	lines = append(lines, g.stdoutLines()...)
+	lines, err := g.exec(ctx, "info locals")
+	if err != nil {
+		return nil, err
+	}
+	args, err := g.exec(ctx, "info args")
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, args...)
 
 	properties := make([]dbgp.Property, 0)
 
 	for _, l := range lines {
-		matches, err := reExtract("(.+) = (.+) ?(.+)?", l, 1, 2)
+		matches, err := console.Extract("(.+) = (.+) ?(.+)?", l, 1, 2)
 		if err != nil {
 			return nil, err
 		}
@@ -125,33 +273,72 @@ func (g *GDB) ContextGet(depth, context int) ([]dbgp.Property, error) {
 			Name:     name,
 			Fullname: name,
 			Address:  address,
-			Type:     g.getType(name),
+			Type:     g.getType(ctx, name),
 		})
 	}
 
 	return properties, nil
 }
 
-func (g *GDB) PropertyGet(depth, context int, name string) (string, error) {
-	g.stdin <- "p " + name
-	lines := g.stdoutLines()
+func (g *GDB) PropertyGet(ctx context.Context, depth, context int, name string) (dbgp.Property, error) {
+	if err := g.checkExpression(name); err != nil {
+		return dbgp.Property{}, err
+	}
+	lines, err := g.exec(ctx, "p "+name)
+	if err != nil {
+		return dbgp.Property{}, err
+	}
 	if len(lines) == 0 {
-		return "", fmt.Errorf("No output produced.")
+		return dbgp.Property{}, fmt.Errorf("No output produced.")
+	}
+	vals, err := console.Extract("\\$[0-9]+ = (.+)", strings.Join(lines, "\n"), 1)
+	if err != nil {
+		return dbgp.Property{}, fmt.Errorf("%s", strings.Join(lines, " "))
+	}
+	return dbgp.Property{
+		Name:     name,
+		Fullname: name,
+		Type:     g.getType(ctx, name),
+		Value:    vals[0],
+	}, nil
+}
+
+// PropertySet assigns a value to a variable
+func (g *GDB) PropertySet(ctx context.Context, depth, context int, name, value string) error {
+	if err := g.checkExpression(name); err != nil {
+		return err
 	}
-	vals, err := reExtract("\\$[0-9]+ = (.+)", lines[0], 1)
-	return vals[0], err
+	if err := g.checkValue(value); err != nil {
+		return err
+	}
+	lines, err := g.exec(ctx, "set var "+name+" = "+strings.TrimSpace(value))
+	if err != nil {
+		return err
+	}
+	if len(lines) > 0 {
+		return fmt.Errorf("%s", strings.Join(lines, " "))
+	}
+	return nil
 }
 
-func (g *GDB) BreakpointSet(bpType, fileName string, lineNumber int) (dbgp.Breakpoint, error) {
+func (g *GDB) BreakpointSet(ctx context.Context, bpType, fileName string, lineNumber int) (dbgp.Breakpoint, error) {
 	if bpType != "line" {
 		return dbgp.Breakpoint{}, fmt.Errorf("only line breakpoints are supported.")
 	}
 
-	cmd := fmt.Sprintf("b %s:%d", stripAbsFilePrefix(fileName), lineNumber)
-	g.stdin <- "set breakpoint pending on"
-	g.stdin <- cmd
+	file, err := quoteFile(fileName)
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	if _, err := g.exec(ctx, "set breakpoint pending on"); err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	lines, err := g.exec(ctx, fmt.Sprintf("break -source %s -line %d", file, lineNumber))
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
 
-	matches, err := reExtract("Breakpoint ([0-9]+) ", strings.Join(g.stdoutLines(), "\n"), 1)
+	matches, err := console.Extract("Breakpoint ([0-9]+) ", strings.Join(lines, "\n"), 1)
 	if err != nil {
 		return dbgp.Breakpoint{}, err
 	}
@@ -159,43 +346,192 @@ func (g *GDB) BreakpointSet(bpType, fileName string, lineNumber int) (dbgp.Break
 	return dbgp.Breakpoint{ID: bpNum, State: "enabled"}, err
 }
 
+// SetHitCondition maps the ">=" hit condition onto gdb's ignore count, so
+// the program runs through the first value-1 hits without stopping. The other
+// conditions are left to the dbgp package.
+func (g *GDB) SetHitCondition(ctx context.Context, id, value int, condition string) (bool, error) {
+	if condition != ">=" {
+		return false, nil
+	}
+	if value > 1 {
+		lines, err := g.exec(ctx, fmt.Sprintf("ignore %d %d", id, value-1))
+		if err != nil {
+			return false, err
+		}
+		for _, l := range lines {
+			if strings.HasPrefix(l, "No breakpoint number") {
+				return false, fmt.Errorf("%s", l)
+			}
+		}
+	}
+	return true, nil
+}
+
+// Option configures how the debugged program is started and how gdb is
+// driven
+type Option func(*options)
+
+type options struct {
+	launch.Options
+	allowed        []string
+	unsafeEval     bool
+	timeouts       map[string]time.Duration
+	signals        []signalPolicy
+	record, replay bool
+}
+
+// launchOption adapts an option shared with the other backends
+func launchOption(opt launch.Option) Option {
+	return func(o *options) { opt(&o.Options) }
+}
+
+// WithArgs sets the arguments passed to the target program
+func WithArgs(args ...string) Option {
+	return launchOption(launch.WithArgs(args...))
+}
+
+// WithEnv sets environment variables ("KEY=VAL") for the target program
+func WithEnv(env ...string) Option {
+	return launchOption(launch.WithEnv(env...))
+}
+
+// WithDir sets the working directory of gdb and the target program
+func WithDir(dir string) Option {
+	return launchOption(launch.WithDir(dir))
+}
+
+// WithStdio redirects the target program's stdin, stdout and stderr to the
+// named files. Empty names are left untouched.
+func WithStdio(stdin, stdout, stderr string) Option {
+	return launchOption(launch.WithStdio(stdin, stdout, stderr))
+}
+
+// WithTimeout sets the timeout of a gdb command such as "info", "print" or
+// "continue", after which gdb is interrupted. Zero disables the timeout.
+// Commands resuming the program have no timeout by default, all others
+// DefaultTimeout.
+func WithTimeout(command string, d time.Duration) Option {
+	return func(o *options) {
+		if o.timeouts == nil {
+			o.timeouts = make(map[string]time.Duration)
+		}
+		o.timeouts[commandName(command)] = d
+	}
+}
+
 // creates a new GDB DBGP Proxy for the specified targert
-func New(target, ideKey, session string) (*GDB, error) {
-	cmd := exec.Command("gdb", target)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, err
+func New(target, ideKey, session string, opts ...Option) (*GDB, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
 	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
+	if err := o.Check(); err != nil {
 		return nil, err
 	}
-	stdin, err := cmd.StdinPipe()
+	for _, s := range o.signals {
+		if err := s.check(); err != nil {
+			return nil, err
+		}
+	}
+
+	cmd, prompt := exec.Command("gdb", append([]string{"--args", target}, o.Args...)...), "(gdb) "
+	if o.replay {
+		if len(o.Args)+len(o.Env) > 0 || o.Stdin+o.Stdout+o.Stderr != "" {
+			return nil, fmt.Errorf("arguments, environment and redirections are fixed by the rr trace")
+		}
+		args := []string{"replay"}
+		if target != "" {
+			args = append(args, target)
+		}
+		cmd, prompt = exec.Command("rr", args...), "(rr) "
+	}
+	con, err := console.Start(cmd, prompt)
 	if err != nil {
 		return nil, err
 	}
-	if err := cmd.Start(); err != nil {
+	g := &GDB{
+		status:     "starting",
+		ideKey:     ideKey,
+		session:    session,
+		con:        con,
+		runArgs:    redirections(o.Stdin, o.Stdout, o.Stderr),
+		record:     o.record,
+		replay:     o.replay,
+		features:   dbgp.Features{},
+		policy:     newPolicy(o.allowed),
+		unsafeEval: o.unsafeEval,
+		timeouts:   o.timeouts,
+		exceptions: make(map[int]string),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	if _, err := con.WaitPrompt(ctx); err != nil {
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("waiting for gdb to start: %v", err)
+	}
+	// output must not stop for confirmation or paging, and frames are
+	// printed with absolute file names
+	for _, setting := range []string{"confirm off", "pagination off", "height 0", "width 0", "filename-display absolute"} {
+		g.exec(context.Background(), "set "+setting)
+	}
+	if err := g.setup(context.Background(), o); err != nil {
+		cmd.Process.Kill()
 		return nil, err
 	}
-	// start io goroutines
-	errChan := make(chan error)
-	return &GDB{
-		status:   "starting",
-		ideKey:   ideKey,
-		session:  session,
-		cmd:      cmd,
-		stdout:   scanReaderToan(stdout, errChan),
-		stderr:   scanReaderToan(stderr, errChan),
-		stdin:    stringanToWriter(stdin, errChan),
-		errChan:  errChan,
-		features: dbgp.Features{},
-	}, nil
+	return g, nil
+}
+
+// setup applies the working directory, environment and signal handling of
+// the program, returning gdb's complaint if it rejects one of them
+func (g *GDB) setup(ctx context.Context, o options) error {
+	if o.Dir != "" {
+		lines, err := g.exec(ctx, "cd "+o.Dir)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(firstLine(lines), "Working directory ") {
+			return fmt.Errorf("changing directory to %s: %s", o.Dir, strings.Join(lines, " "))
+		}
+	}
+	for _, kv := range o.Env {
+		lines, err := g.exec(ctx, "set environment "+kv)
+		if err != nil {
+			return err
+		}
+		// gdb only warns about empty values
+		if l := firstLine(lines); l != "" && !strings.HasPrefix(l, "Setting environment variable") {
+			return fmt.Errorf("setting environment variable %s: %s", kv, strings.Join(lines, " "))
+		}
+	}
+	for _, s := range o.signals {
+		lines, err := g.exec(ctx, "handle "+s.signal+" "+strings.Join(s.actions, " "))
+		if err != nil {
+			return err
+		}
+		// gdb prints the new handling of the signal as a table
+		if !strings.HasPrefix(firstLine(lines), "Signal") {
+			return fmt.Errorf("handling signal %s: %s", s.signal, strings.Join(lines, " "))
+		}
+	}
+	return nil
+}
+
+// firstLine returns the first non-empty line of gdb's output
+func firstLine(lines []string) string {
+	for _, l := range lines {
+		if l = strings.TrimSpace(l); l != "" {
+			return l
+		}
+	}
+	return ""
 }
 
 // get the type for a symbol
-func (g *GDB) getType(symbol string) string {
-	g.stdin <- "ptype " + symbol
-	typeInfo := g.stdoutLines()
+func (g *GDB) getType(ctx context.Context, symbol string) string {
+	if g.checkExpression(symbol) != nil {
+		return "unknown"
+	}
+	typeInfo, _ := g.exec(ctx, "ptype "+symbol)
 	if len(typeInfo) == 0 {
 		return "unknown"
 	}
@@ -206,23 +542,23 @@ func (g *GDB) getType(symbol string) string {
 }
 
 // Obtain the current filename and language via "info source"
-func (g *GDB) currentFilenameAndLang() (lineNumber, lang string, err error) {
+func (g *GDB) currentFilenameAndLang(ctx context.Context) (lineNumber, lang string, err error) {
 	//go io.Copy(g.stdin, os.Stdin) // @todo consider user stdin
-	g.stdin <- "list 1"
 	// not interested in list output, needed for "info source"
-	g.stdoutLines()
-	g.stdin <- "info source"
-
-	sourceInfo := g.stdoutLines()
+	g.exec(ctx, "list 1")
+	sourceInfo, err := g.exec(ctx, "info source")
+	if err != nil {
+		return
+	}
 	info := strings.Join(sourceInfo, "\n")
 
 	// extract meaningful things
-	fileNameMatches, e := reExtract("Current source file is (.+)", info, 1)
+	fileNameMatches, e := console.Extract("Current source file is (.+)", info, 1)
 	if e != nil {
 		err = e
 		return
 	}
-	langMatches, e := reExtract("Source language is (.+).", info, 1)
+	langMatches, e := console.Extract("Source language is (.+).", info, 1)
 	if e != nil {
 		err = e
 		return
@@ -232,100 +568,18 @@ func (g *GDB) currentFilenameAndLang() (lineNumber, lang string, err error) {
 	return fileNameMatches[0], langMatches[0], nil
 }
 
-// Obtain the current line number
-func (g *GDB) currentLineNumber() (int, error) {
-	//go io.Copy(g.stdin, os.Stdin) // @todo consider user stdin
-	g.stdin <- "where"
-	lineInfo := g.stdoutLines()
-	parts := strings.Join(lineInfo, "\n")
-
-	whereRe := regexp.MustCompile("at (.+):([0-9]+)")
-
-	matches := whereRe.FindStringSubmatch(parts)
-
-	if len(matches) != 3 {
-		return 0, fmt.Errorf("unexpected match length, expected 3: %s", fmt.Sprint(matches))
-	}
-	return strconv.Atoi(matches[2])
-}
-
-// Get stdout lines, waiting defaultWait
-func (g *GDB) stdoutLines() []string {
-	result := g.consumeLines(g.stdout, defaultWait)
-	for i, l := range result {
-		result[i] = strings.Replace(l, "(gdb) ", "", 1)
-	}
-	return result
-}
-
-// consumes c until it doesn't respond in maxWait time
-func (g *GDB) consumeLines(c <-chan string, maxWait time.Duration) []string {
-	result := make([]string, 0, 10)
-	for {
-		select {
-		case line := <-c:
-			result = append(result, line)
-			glog.V(2).Infoln("(gdb) ", line)
-		case err := <-g.errChan:
-			glog.Warningln("error while consuming:", err)
-		case <-time.After(maxWait): // give other end of the channel some time
-			return result
+// builds the shell redirections for gdb's run command
+func redirections(stdin, stdout, stderr string) string {
+	var parts []string
+	for _, r := range []struct{ op, file string }{{"<", stdin}, {">", stdout}, {"2>", stderr}} {
+		if r.file != "" {
+			parts = append(parts, r.op+" "+shellQuote(r.file))
 		}
 	}
+	return strings.Join(parts, " ")
 }
 
-// Consumes the reader and generates a string for every newline read
-func scanReaderToan(r io.Reader, errChan chan<- error) <-chan string {
-	c := make(chan string)
-	scanner := bufio.NewScanner(r)
-	go func() {
-		for scanner.Scan() {
-			c <- scanner.Text()
-		}
-		if err := scanner.Err(); err != nil {
-			errChan <- err
-		}
-	}()
-	return c
-}
-
-// Provides a writable channel of strings as the interface to a writer. Newlines
-// are automatically appended
-func stringanToWriter(w io.Writer, errChan chan<- error) chan<- string {
-	c := make(chan string)
-	bw := bufio.NewWriter(w)
-	go func() {
-		for {
-			s := <-c
-			_, err := bw.WriteString(s)
-			if err != nil {
-				errChan <- err
-			}
-			_, err = bw.WriteString("\n")
-			if err != nil {
-				errChan <- err
-			}
-			glog.V(1).Infoln("(gdb) ", s)
-			bw.Flush()
-		}
-	}()
-	return c
-}
-
-// Strips "file://" from the beginning of a string
-func stripAbsFilePrefix(lineNumber string) string {
-	return strings.TrimPrefix(lineNumber, "file://")
-}
-
-// extracts the specified matchGroups from target based on regex
-func reExtract(regex, target string, matchGroup ...int) ([]string, error) {
-	results := make([]string, 0)
-	matches := regexp.MustCompile(regex).FindStringSubmatch(target)
-	for _, mg := range matchGroup {
-		if mg > len(matches)-1 {
-			return nil, fmt.Errorf("not enough matches")
-		}
-		results = append(results, matches[mg])
-	}
-	return results, nil
+// quotes s for the shell gdb starts the program with
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
 }
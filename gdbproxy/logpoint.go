@@ -0,0 +1,111 @@
+package gdbproxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/internal/policy"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// logRe matches the lines printed by logpoints, which are prefixed with the
+// index of the logpoint in GDB.logpoints
+var logRe = regexp.MustCompile(`^dbgp-log ([0-9]+): (.*)$`)
+
+// asStringRe matches the value printed for $_as_string(1)
+var asStringRe = regexp.MustCompile(`^\$[0-9]+ = "1"$`)
+
+// LogpointSet logs message with gdb's dprintf whenever the line is reached.
+// The expressions of message are printed with $_as_string, which requires
+// gdb's Python support; without it, messages with expressions are
+// unimplemented and left to Conn. gdb prints the messages while the program
+// runs, they are notified once it stops.
+func (g *GDB) LogpointSet(ctx context.Context, fileName string, lineNumber int, message string) (dbgp.Breakpoint, error) {
+	literals, exprs, err := dbgp.SplitLogMessage(message)
+	if err != nil || policy.HasControl(message) {
+		return dbgp.Breakpoint{}, dbgp.ErrInvalidOpts
+	}
+	if len(exprs) > 0 {
+		ok, err := g.hasAsString(ctx)
+		if err != nil {
+			return dbgp.Breakpoint{}, err
+		}
+		if !ok {
+			return dbgp.Breakpoint{}, dbgp.ErrUnimplemented
+		}
+	}
+	file, err := quoteFile(fileName)
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	format := fmt.Sprintf("dbgp-log %d: ", len(g.logpoints))
+	args := ""
+	for i, expr := range exprs {
+		if err := g.checkExpression(expr); err != nil {
+			return dbgp.Breakpoint{}, err
+		}
+		format += printfEscape(literals[i]) + "%s"
+		args += ",$_as_string(" + expr + ")"
+	}
+	format += printfEscape(literals[len(exprs)]) + `\n`
+
+	if _, err := g.exec(ctx, "set breakpoint pending on"); err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	lines, err := g.exec(ctx, fmt.Sprintf(`dprintf -source %s -line %d,"%s"%s`, file, lineNumber, format, args))
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	for _, l := range lines {
+		// Dprintf 2 at 0x1139: file t.c, line 5.
+		if strings.HasPrefix(l, "Dprintf ") {
+			id, err := strconv.Atoi(strings.Fields(l)[1])
+			if err != nil {
+				return dbgp.Breakpoint{}, err
+			}
+			g.logpoints = append(g.logpoints, id)
+			return dbgp.Breakpoint{ID: id, State: "enabled"}, nil
+		}
+	}
+	return dbgp.Breakpoint{}, fmt.Errorf("%s", strings.Join(lines, " "))
+}
+
+// hasAsString reports whether gdb has the $_as_string function, which is
+// written in Python, probing for it once
+func (g *GDB) hasAsString(ctx context.Context) (bool, error) {
+	if g.asString == nil {
+		lines, err := g.exec(ctx, "print $_as_string(1)")
+		if err != nil {
+			return false, err
+		}
+		ok := asStringRe.MatchString(firstLine(lines))
+		if !ok {
+			glog.Warningln("[gdbproxy] no $_as_string, logpoint expressions are evaluated by Conn:", firstLine(lines))
+		}
+		g.asString = &ok
+	}
+	return *g.asString, nil
+}
+
+// printfEscape escapes text for a gdb printf format string
+func printfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`).Replace(s)
+}
+
+// logged returns notifications of the messages logged by logpoints
+func (g *GDB) logged(lines []string) []dbgp.Notification {
+	var notes []dbgp.Notification
+	for _, l := range lines {
+		m := logRe.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		if i, _ := strconv.Atoi(m[1]); i < len(g.logpoints) {
+			notes = append(notes, dbgp.Notification{Name: "x_log", BreakpointID: g.logpoints[i], Text: m[2]})
+		}
+	}
+	return notes
+}
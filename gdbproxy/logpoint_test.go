@@ -0,0 +1,59 @@
+package gdbproxy
+
+import (
+	"github.com/traviscline/dbgp"
+	"reflect"
+	"testing"
+)
+
+func TestPrintfEscape(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"plain", "plain"},
+		{"", ""},
+		{"100%", "100%%"},
+		{"%s %d", "%%s %%d"},
+		{`say "hi"`, `say \"hi\"`},
+		{`C:\dir\n`, `C:\\dir\\n`},
+		{`\"%`, `\\\"%%`},
+	} {
+		if got := printfEscape(tt.in); got != tt.want {
+			t.Errorf("printfEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAsStringRe(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		want bool
+	}{
+		{`$1 = "1"`, true},
+		{`$12 = "1"`, true},
+		{"Invalid data type for function to be called.", false},
+		{"$1 = void", false},
+		{`$1 = 1`, false},
+	} {
+		if got := asStringRe.MatchString(tt.line); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestLogged(t *testing.T) {
+	g := &GDB{logpoints: []int{4, 7}}
+	got := g.logged([]string{
+		"dbgp-log 0: x is 1",
+		"output of the program",
+		"dbgp-log 1: 100% {done}",
+		"dbgp-log 2: unknown logpoint",
+		"dbgp-log 1: ",
+	})
+	want := []dbgp.Notification{
+		{Name: "x_log", BreakpointID: 4, Text: "x is 1"},
+		{Name: "x_log", BreakpointID: 7, Text: "100% {done}"},
+		{Name: "x_log", BreakpointID: 7, Text: ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
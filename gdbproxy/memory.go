@@ -0,0 +1,52 @@
+package gdbproxy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the address a line printed by x starts with, e.g. "0x601040 <ns::buf+8>:",
+// symbols of templates containing angle brackets themselves
+var memoryAddressRe = regexp.MustCompile(`^0x[0-9a-f]+(?: <.*>)?:\s*`)
+
+// ReadMemory reads memory of the program with gdb's x command
+func (g *GDB) ReadMemory(ctx context.Context, address uint64, size int) ([]byte, error) {
+	lines, err := g.exec(ctx, fmt.Sprintf("x /%dxb 0x%x", size, address))
+	if err != nil {
+		return nil, err
+	}
+	b, err := parseMemory(lines)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != size {
+		return nil, fmt.Errorf("read %d of %d bytes at 0x%x", len(b), size, address)
+	}
+	return b, nil
+}
+
+// parseMemory parses the bytes printed by x /xb
+func parseMemory(lines []string) ([]byte, error) {
+	var b []byte
+	for _, l := range lines {
+		// 0x601040 <buf>:	0x68	0x69	0x00 ...
+		if i := strings.Index(l, "Cannot access memory"); i >= 0 {
+			return nil, fmt.Errorf("%s", l[i:])
+		}
+		loc := memoryAddressRe.FindStringIndex(l)
+		if loc == nil {
+			continue
+		}
+		for _, f := range strings.Fields(l[loc[1]:]) {
+			v, err := strconv.ParseUint(f, 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected output of x: %s", l)
+			}
+			b = append(b, byte(v))
+		}
+	}
+	return b, nil
+}
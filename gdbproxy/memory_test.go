@@ -0,0 +1,35 @@
+package gdbproxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMemory(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		lines []string
+		want  []byte
+		err   bool
+	}{
+		{"symbol", []string{"0x601040 <buf>:\t0x68\t0x69\t0x00"}, []byte{0x68, 0x69, 0x00}, false},
+		{"no symbol", []string{"0x601040:\t0x01\t0x02"}, []byte{0x01, 0x02}, false},
+		{"namespace", []string{"0x601048 <ns::buf+8>:\t0x0a\t0xff"}, []byte{0x0a, 0xff}, false},
+		{"template", []string{"0x601050 <std::vector<int, std::allocator<int> >::data>:\t0x2a"}, []byte{0x2a}, false},
+		{
+			"lines",
+			[]string{"0x601040 <buf>:\t0x00\t0x01\t0x02\t0x03\t0x04\t0x05\t0x06\t0x07", "0x601048 <buf+8>:\t0x08"},
+			[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8}, false,
+		},
+		{"inaccessible", []string{"0x0:\tCannot access memory at address 0x0"}, nil, true},
+	} {
+		got, err := parseMemory(tt.lines)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.name, err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got % x, want % x", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package gdbproxy
+
+import (
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/internal/policy"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Everything sent to gdb passes an allowlist of commands, and IDE supplied
+// names, expressions and file names are validated before they are
+// interpolated, see package policy.
+
+// defaultAllowed are the gdb commands issued by the proxy itself. "set",
+// "info", "catch" and "record" are further restricted to the subcommands in
+// allowedSubcommands.
+var defaultAllowed = []string{
+	"awatch", "break", "catch", "cd", "continue", "disassemble", "dprintf", "handle", "ignore", "info",
+	"list", "next", "nexti", "print", "ptype", "record", "reverse-continue", "reverse-finish", "reverse-next",
+	"reverse-step", "run", "rwatch", "set", "step", "stepi", "watch", "whatis", "where", "x",
+}
+
+// aliases of allowed commands, resolved before checking the allowlist
+var aliases = map[string]string{
+	"b": "break", "c": "continue", "n": "next", "p": "print", "s": "step", "bt": "where",
+	"si": "stepi", "ni": "nexti", "rs": "reverse-step", "rn": "reverse-next", "rc": "reverse-continue",
+}
+
+var allowedSubcommands = map[string][]string{
+	"catch":  {"catch", "signal", "throw"},
+	"record": {"full"},
+	"set":    {"breakpoint", "confirm", "environment", "height", "pagination", "var", "variable", "width"},
+	"info":   {"args", "locals", "source"},
+}
+
+// WithAllowedCommands adds gdb commands to the allowlist, e.g. for forks of
+// the proxy issuing additional commands. Subcommands of "set" and "info" are
+// allowed as "set print", "info frame" etc.
+func WithAllowedCommands(cmds ...string) Option {
+	return func(o *options) { o.allowed = append(o.allowed, cmds...) }
+}
+
+// WithUnsafeEval lifts the restriction of property names to plain variable
+// references, so the IDE can evaluate arbitrary expressions. Expressions may
+// call functions of the program and thus run arbitrary code in it.
+func WithUnsafeEval() Option {
+	return func(o *options) { o.unsafeEval = true }
+}
+
+// newPolicy returns the policy of the gdb commands issued by the proxy, and
+// the extra commands allowed with WithAllowedCommands
+func newPolicy(extra []string) *policy.Policy {
+	return policy.New("gdb", defaultAllowed, allowedSubcommands, aliases, extra)
+}
+
+// commandName returns the gdb command of a command line, resolving aliases
+func commandName(line string) string {
+	return policy.CommandName(line, aliases)
+}
+
+// checkExpression validates an IDE supplied property name or expression
+func (g *GDB) checkExpression(expr string) error {
+	if expr == "" || policy.HasControl(expr) {
+		return dbgp.ErrInvalidOpts
+	}
+	if !g.unsafeEval && !policy.IsVariable(expr) {
+		return fmt.Errorf("%q is not a variable reference, expressions require unsafe eval", expr)
+	}
+	return nil
+}
+
+// literalRe matches number, character and boolean literals
+var literalRe = regexp.MustCompile(`^(-?[0-9]+(\.[0-9]*)?([eE][-+]?[0-9]+)?[uUlLfF]*|0[xX][0-9a-fA-F]+[uUlL]*|'(\\.|[^'\\])'|true|false)$`)
+
+// checkValue validates an IDE supplied value assigned to a variable, a
+// literal or another variable unless evaluation is unsafe
+func (g *GDB) checkValue(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" || policy.HasControl(value) {
+		return dbgp.ErrInvalidOpts
+	}
+	if !g.unsafeEval && !literalRe.MatchString(value) && !policy.IsVariable(value) {
+		return fmt.Errorf("%q is not a literal or variable reference, expressions require unsafe eval", value)
+	}
+	return nil
+}
+
+// quoteFile quotes a file name for an explicit gdb location
+func quoteFile(name string) (string, error) {
+	if name == "" || policy.HasControl(name) || strings.ContainsAny(name, `"\`) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return strconv.Quote(name), nil
+}
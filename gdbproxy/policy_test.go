@@ -0,0 +1,79 @@
+package gdbproxy
+
+import "testing"
+
+func TestPolicy(t *testing.T) {
+	p := newPolicy([]string{"info frame"})
+	tests := []struct {
+		line string
+		ok   bool
+	}{
+		{"break -source \"main.c\" -line 3", true},
+		{"b 1", true},
+		{"catch throw ^std::runtime_error$", true},
+		{"catch load", false},
+		{"record full", true},
+		{"record btrace", false},
+		{"info locals", true},
+		{"info frame", true},
+		{"info proc", false},
+		{"set var x = 1", true},
+		{"set logging on", false},
+		{"ignore 1 2", true},
+		{"dprintf -source \"t.c\" -line 5,\"x\\n\"", true},
+		{"shell id", false},
+		{"python import os", false},
+		{"source /tmp/x.gdb", false},
+		{"print x\nshell id", false},
+	}
+	for _, tt := range tests {
+		if err := p.Check(tt.line); (err == nil) != tt.ok {
+			t.Errorf("Check(%q) = %v, want ok %v", tt.line, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckExpression(t *testing.T) {
+	g := &GDB{}
+	for expr, ok := range map[string]bool{"x": true, "a->b[2]": true, "f()": false, "x\ny": false, "": false} {
+		if err := g.checkExpression(expr); (err == nil) != ok {
+			t.Errorf("checkExpression(%q) = %v, want ok %v", expr, err, ok)
+		}
+	}
+	g.unsafeEval = true
+	if err := g.checkExpression("f()"); err != nil {
+		t.Errorf("checkExpression(f()) with unsafe eval: %v", err)
+	}
+	if err := g.checkExpression("f()\nshell id"); err == nil {
+		t.Error("checkExpression accepted control characters with unsafe eval")
+	}
+}
+
+func TestCheckValue(t *testing.T) {
+	g := &GDB{}
+	for value, ok := range map[string]bool{"1": true, "-2.5e3": true, "0x1F": true, "'a'": true, "'\\n'": true,
+		"true": true, "y": true, " 3 ": true, "f()": false, "1+1": false, "": false} {
+		if err := g.checkValue(value); (err == nil) != ok {
+			t.Errorf("checkValue(%q) = %v, want ok %v", value, err, ok)
+		}
+	}
+}
+
+func TestQuoteFile(t *testing.T) {
+	tests := []struct {
+		name, quoted string
+	}{
+		{"/src/main.c", `"/src/main.c"`},
+		{"dir with space/a.c", `"dir with space/a.c"`},
+		{`a"b.c`, ""},
+		{`a\b.c`, ""},
+		{"a\nb.c", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := quoteFile(tt.name)
+		if got != tt.quoted || (err == nil) != (tt.quoted != "") {
+			t.Errorf("quoteFile(%q) = %q, %v, want %q", tt.name, got, err, tt.quoted)
+		}
+	}
+}
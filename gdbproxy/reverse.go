@@ -0,0 +1,57 @@
+package gdbproxy
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithRecord records the execution of the program with gdb's "record full"
+// from the first stop on, so it can be executed backwards. Recording slows
+// the program down considerably.
+func WithRecord() Option {
+	return func(o *options) { o.record = true }
+}
+
+// WithReplay replays an rr trace directory, given as target to New, with
+// "rr replay" instead of running a program under gdb. An empty target
+// replays the latest trace. Arguments, environment and redirections were
+// fixed when recording, so they cannot be combined with WithReplay.
+func WithReplay() Option {
+	return func(o *options) { o.replay = true }
+}
+
+// StepIntoBack steps backwards with reverse-step
+func (g *GDB) StepIntoBack(ctx context.Context) (status, reason string, err error) {
+	return g.reverse(ctx, "reverse-step")
+}
+
+// StepOverBack steps backwards over calls with reverse-next
+func (g *GDB) StepOverBack(ctx context.Context) (status, reason string, err error) {
+	return g.reverse(ctx, "reverse-next")
+}
+
+// StepOutBack runs backwards to the call of the current function with
+// reverse-finish
+func (g *GDB) StepOutBack(ctx context.Context) (status, reason string, err error) {
+	return g.reverse(ctx, "reverse-finish")
+}
+
+// RunBack runs backwards until a breakpoint or the beginning of the history
+// with reverse-continue
+func (g *GDB) RunBack(ctx context.Context) (status, reason string, err error) {
+	return g.reverse(ctx, "reverse-continue")
+}
+
+// reverse runs a command executing the program backwards. Unless replaying
+// or recording gdb refuses it, which is returned as error.
+func (g *GDB) reverse(ctx context.Context, line string) (status, reason string, err error) {
+	switch {
+	case g.status == "starting":
+		return "", "", fmt.Errorf("the program is not running")
+	case g.status == "stopping" && g.replay:
+		// rr keeps the exited program around, its history can still be
+		// executed backwards
+		g.status = "break"
+	}
+	return g.resume(ctx, line)
+}
@@ -0,0 +1,72 @@
+package gdbproxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/internal/console"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// signalNameRe matches the signals accepted by gdb's handle and catch signal
+// commands
+var signalNameRe = regexp.MustCompile(`^(SIG[A-Z0-9]+|[0-9]+|all)$`)
+
+// signalActions are the actions of gdb's handle command
+var signalActions = map[string]bool{
+	"stop": true, "nostop": true, "print": true, "noprint": true, "pass": true, "nopass": true,
+}
+
+// signalPolicy is the handling of one signal
+type signalPolicy struct {
+	signal  string
+	actions []string
+}
+
+// WithSignal sets how gdb treats a signal of the program, like gdb's handle
+// command: actions are "stop" or "nostop", "print" or "noprint" and "pass"
+// or "nopass", e.g. WithSignal("SIGUSR1", "nostop", "noprint", "pass").
+// Signals caught with an exception breakpoint stop the program regardless.
+func WithSignal(signal string, actions ...string) Option {
+	return func(o *options) { o.signals = append(o.signals, signalPolicy{signal, actions}) }
+}
+
+// check validates the signal and actions
+func (s signalPolicy) check() error {
+	if !signalNameRe.MatchString(s.signal) {
+		return fmt.Errorf("invalid signal %q", s.signal)
+	}
+	if len(s.actions) == 0 {
+		return fmt.Errorf("no actions for signal %s", s.signal)
+	}
+	for _, a := range s.actions {
+		if !signalActions[a] {
+			return fmt.Errorf("invalid action %q for signal %s, expected one of stop, nostop, print, noprint, pass, nopass", a, s.signal)
+		}
+	}
+	return nil
+}
+
+// ExceptionBreakpointSet catches a signal such as "SIGSEGV" or "SIGFPE", or
+// all signals but SIGINT and SIGTRAP for "*". The program stops with the
+// frame receiving the signal selected and reports the signal as exception.
+// Other names catch C++ exceptions and Go panics, see catchException.
+func (g *GDB) ExceptionBreakpointSet(ctx context.Context, name string) (dbgp.Breakpoint, error) {
+	if name == "*" {
+		name = ""
+	} else if !signalNameRe.MatchString(name) {
+		return g.catchException(ctx, name)
+	}
+	lines, err := g.exec(ctx, strings.TrimSpace("catch signal "+name))
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	matches, err := console.Extract("Catchpoint ([0-9]+) ", strings.Join(lines, "\n"), 1)
+	if err != nil {
+		return dbgp.Breakpoint{}, fmt.Errorf("%s", strings.Join(lines, " "))
+	}
+	bpNum, err := strconv.Atoi(matches[0])
+	return dbgp.Breakpoint{ID: bpNum, State: "enabled"}, err
+}
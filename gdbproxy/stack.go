@@ -0,0 +1,41 @@
+package gdbproxy
+
+import (
+	"github.com/traviscline/dbgp"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// a frame printed by where, e.g.
+// #1  0x0000555555555150 in main (argc=1, argv=0x7fffffffe0a8) at main.c:12
+var stackFrameRe = regexp.MustCompile(`^#([0-9]+)\s+(?:0x[0-9a-f]+ in )?(\S+) \(`)
+
+// parseStack parses the frames printed by where, joining the lines gdb wraps
+// long argument lists onto
+func parseStack(lines []string) []dbgp.Stack {
+	var frames []string
+	for _, l := range lines {
+		switch {
+		case strings.HasPrefix(l, "#"):
+			frames = append(frames, l)
+		case len(frames) > 0 && strings.HasPrefix(l, " "):
+			frames[len(frames)-1] += " " + strings.TrimSpace(l)
+		}
+	}
+	var stack []dbgp.Stack
+	for _, f := range frames {
+		m := stackFrameRe.FindStringSubmatch(f)
+		if m == nil {
+			continue
+		}
+		level, _ := strconv.Atoi(m[1])
+		s := dbgp.Stack{Level: level, Type: "file", Where: m[2]}
+		if loc := locationRe.FindStringSubmatch(f); loc != nil {
+			s.Filename = loc[1]
+			s.Lineno, _ = strconv.Atoi(loc[2])
+		}
+		stack = append(stack, s)
+	}
+	return stack
+}
@@ -0,0 +1,27 @@
+package gdbproxy
+
+import (
+	"github.com/traviscline/dbgp"
+	"reflect"
+	"testing"
+)
+
+func TestParseStack(t *testing.T) {
+	lines := []string{
+		"#0  add (a=1, b=2) at /src/add.c:3",
+		"#1  0x0000555555555169 in compute (values=0x7fffffffe0a0, ",
+		"    count=3) at /src/main.c:10",
+		"#2  0x00005555555551a4 in main () at /src/main.c:17",
+		"#3  0x00007ffff7dea083 in __libc_start_main () from /lib/x86_64-linux-gnu/libc.so.6",
+		"Backtrace stopped: previous frame inner to this frame (corrupt stack?)",
+	}
+	want := []dbgp.Stack{
+		{Level: 0, Type: "file", Filename: "/src/add.c", Lineno: 3, Where: "add"},
+		{Level: 1, Type: "file", Filename: "/src/main.c", Lineno: 10, Where: "compute"},
+		{Level: 2, Type: "file", Filename: "/src/main.c", Lineno: 17, Where: "main"},
+		{Level: 3, Type: "file", Where: "__libc_start_main"},
+	}
+	if got := parseStack(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
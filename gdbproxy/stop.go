@@ -0,0 +1,136 @@
+package gdbproxy
+
+import (
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Stop events printed by gdb when the program stops
+var (
+	exitedRe     = regexp.MustCompile(`\[Inferior [0-9]+ \(.*\) exited (normally|with code ([0-9]+))\]`)
+	signalRe     = regexp.MustCompile(`Program received signal (SIG[A-Z0-9]+), (.+?)\.?$`)
+	caughtRe     = regexp.MustCompile(`Catchpoint ([0-9]+) \(signal (SIG[A-Z0-9]+)\)`)
+	thrownRe     = regexp.MustCompile(`Catchpoint ([0-9]+) \(exception (?:thrown|caught|rethrown)\)`)
+	terminatedRe = regexp.MustCompile(`Program terminated with signal (SIG[A-Z0-9]+), (.+?)\.?$`)
+	locationRe   = regexp.MustCompile(` at (.+):([0-9]+)$`)
+	// reverse execution reached the start of the recording
+	historyRe = regexp.MustCompile(`^No more reverse-execution history\.`)
+	// a breakpoint hit, also printed as Thread 1 "prog" hit Breakpoint 1, ...
+	breakpointRe = regexp.MustCompile(`(?:^|hit )(?:Temporary )?[Bb]reakpoint ([0-9]+), `)
+	// a watchpoint as printed when set and when triggered, e.g.
+	// Hardware access (read/write) watchpoint 2: x
+	watchRe    = regexp.MustCompile(`(?:^|hit )(Hardware (?:read |access \(read/write\) )?w|W)atchpoint ([0-9]+): (.+)$`)
+	oldValueRe = regexp.MustCompile(`^Old value = (.*)$`)
+	valueRe    = regexp.MustCompile(`^(?:New value|Value) = (.*)$`)
+	scopeRe    = regexp.MustCompile(`^Watchpoint ([0-9]+) deleted because the program has left the block in`)
+)
+
+// errors of gdb meaning it could not resume the program, which then stays
+// where it was
+var cannotResume = []string{
+	"does not support this command", // e.g. reverse execution without recording
+	"Could not insert hardware",     // too many hardware watchpoints or breakpoints
+}
+
+// errors of gdb meaning the program cannot be resumed
+var notRunning = []string{"The program is not being run.", "No executable file specified"}
+
+// stopOf derives status, reason and a message from the output of a command
+// resuming the program
+func stopOf(lines []string) (status, reason string, msg *dbgp.Message) {
+	status, reason = "break", "ok"
+	for _, l := range lines {
+		if m := exitedRe.FindStringSubmatch(l); m != nil {
+			code := 0
+			if m[2] != "" {
+				// gdb prints exit codes in octal
+				c, _ := strconv.ParseInt(m[2], 8, 32)
+				code = int(c)
+			}
+			return "stopping", "ok", &dbgp.Message{ExitCode: &code, Text: strings.Trim(l, "[]")}
+		}
+		if m := terminatedRe.FindStringSubmatch(l); m != nil {
+			return "stopping", "exception", &dbgp.Message{Exception: m[1], Text: m[1] + ": " + m[2]}
+		}
+		if m := signalRe.FindStringSubmatch(l); m != nil {
+			if m[1] == "SIGINT" {
+				// interrupted
+				reason = "aborted"
+				continue
+			}
+			reason = "exception"
+			msg = &dbgp.Message{Exception: m[1], Text: m[1] + ": " + m[2]}
+			continue
+		}
+		if m := breakpointRe.FindStringSubmatch(l); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			// the location follows on the same line
+			msg = &dbgp.Message{BreakpointID: id, Text: strings.TrimSuffix(strings.TrimPrefix(m[0], "hit "), ", ")}
+		}
+		if m := watchRe.FindStringSubmatch(l); m != nil {
+			id, _ := strconv.Atoi(m[2])
+			msg = &dbgp.Message{BreakpointID: id, Text: strings.TrimPrefix(m[0], "hit ")}
+			continue
+		}
+		if m := oldValueRe.FindStringSubmatch(l); m != nil && msg != nil {
+			msg.OldValue = m[1]
+			continue
+		}
+		if m := valueRe.FindStringSubmatch(l); m != nil && msg != nil {
+			msg.Value = m[1]
+			continue
+		}
+		if m := scopeRe.FindStringSubmatch(l); m != nil {
+			msg = &dbgp.Message{Text: scopeText(m[1])}
+			continue
+		}
+		if historyRe.MatchString(l) {
+			msg = &dbgp.Message{Text: strings.TrimSuffix(l, ".")}
+			continue
+		}
+		if m := caughtRe.FindStringSubmatch(l); m != nil {
+			// caught by an exception breakpoint, the location follows on
+			// the same line
+			reason = "exception"
+			id, _ := strconv.Atoi(m[1])
+			msg = &dbgp.Message{Exception: m[2], BreakpointID: id, Text: m[0]}
+		}
+		if m := thrownRe.FindStringSubmatch(l); m != nil {
+			// a C++ exception, described by GDB.describeException
+			reason = "exception"
+			id, _ := strconv.Atoi(m[1])
+			msg = &dbgp.Message{BreakpointID: id, Text: m[0]}
+		}
+		for _, e := range notRunning {
+			if strings.Contains(l, e) {
+				return "stopping", "error", &dbgp.Message{Text: l}
+			}
+		}
+		if msg != nil && msg.Filename == "" {
+			// the frame following the signal, gdb only prints base names
+			// unless the program was compiled with absolute paths
+			if m := locationRe.FindStringSubmatch(l); m != nil && path.IsAbs(m[1]) {
+				msg.Filename = m[1]
+				msg.Lineno, _ = strconv.Atoi(m[2])
+			}
+		}
+	}
+	return status, reason, msg
+}
+
+// refusal returns gdb's error if it refused to execute a command resuming
+// the program
+func refusal(lines []string) error {
+	for _, l := range lines {
+		for _, e := range cannotResume {
+			if strings.Contains(l, e) {
+				return fmt.Errorf("%s", l)
+			}
+		}
+	}
+	return nil
+}
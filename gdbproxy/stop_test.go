@@ -0,0 +1,112 @@
+package gdbproxy
+
+import (
+	"github.com/traviscline/dbgp"
+	"reflect"
+	"testing"
+)
+
+func TestStopOf(t *testing.T) {
+	zero, three := 0, 3
+	tests := []struct {
+		name           string
+		lines          []string
+		status, reason string
+		msg            *dbgp.Message
+	}{
+		{
+			"breakpoint",
+			[]string{"", "Breakpoint 1, main () at /src/main.c:5", "5\t  int x = 1;"},
+			"break", "ok", &dbgp.Message{BreakpointID: 1, Text: "Breakpoint 1", Filename: "/src/main.c", Lineno: 5},
+		},
+		{
+			"breakpoint of a thread",
+			[]string{`Thread 2 "prog" hit Breakpoint 12, worker (arg=0x0) at /src/worker.c:9`},
+			"break", "ok", &dbgp.Message{BreakpointID: 12, Text: "Breakpoint 12", Filename: "/src/worker.c", Lineno: 9},
+		},
+		{
+			"temporary breakpoint",
+			[]string{"Temporary breakpoint 2, main () at main.c:3"},
+			"break", "ok", &dbgp.Message{BreakpointID: 2, Text: "Temporary breakpoint 2"},
+		},
+		{
+			"step",
+			[]string{"6\t  x++;"},
+			"break", "ok", nil,
+		},
+		{
+			"watchpoint",
+			[]string{"", "Hardware watchpoint 3: x", "", "Old value = 1", "New value = 2", "main () at /src/main.c:7"},
+			"break", "ok", &dbgp.Message{BreakpointID: 3, Text: "Hardware watchpoint 3: x", OldValue: "1", Value: "2", Filename: "/src/main.c", Lineno: 7},
+		},
+		{
+			"read watchpoint of a thread",
+			[]string{`Thread 1 "prog" hit Hardware read watchpoint 4: y`, "", "Value = 5"},
+			"break", "ok", &dbgp.Message{BreakpointID: 4, Text: "Hardware read watchpoint 4: y", Value: "5"},
+		},
+		{
+			"access watchpoint",
+			[]string{"Hardware access (read/write) watchpoint 5: z", "", "Value = 0"},
+			"break", "ok", &dbgp.Message{BreakpointID: 5, Text: "Hardware access (read/write) watchpoint 5: z", Value: "0"},
+		},
+		{
+			"watchpoint out of scope",
+			[]string{"", "Watchpoint 3 deleted because the program has left the block in", "which its expression is valid."},
+			"break", "ok", &dbgp.Message{Text: scopeText("3")},
+		},
+		{
+			"signal",
+			[]string{"", "Program received signal SIGSEGV, Segmentation fault.", "0x0000555555555131 in main () at /src/main.c:4"},
+			"break", "exception", &dbgp.Message{Exception: "SIGSEGV", Text: "SIGSEGV: Segmentation fault", Filename: "/src/main.c", Lineno: 4},
+		},
+		{
+			"interrupted",
+			[]string{"", "Program received signal SIGINT, Interrupt.", "0x00007ffff7e9a1b4 in read () from /lib/libc.so.6"},
+			"break", "aborted", nil,
+		},
+		{
+			"signal catchpoint",
+			[]string{"", "Catchpoint 2 (signal SIGUSR1), main () at /src/main.c:8"},
+			"break", "exception", &dbgp.Message{Exception: "SIGUSR1", BreakpointID: 2, Text: "Catchpoint 2 (signal SIGUSR1)", Filename: "/src/main.c", Lineno: 8},
+		},
+		{
+			"exception catchpoint",
+			[]string{"", "Catchpoint 6 (exception thrown), 0x00007ffff7e4a672 in __cxa_throw () from /lib/libstdc++.so.6"},
+			"break", "exception", &dbgp.Message{BreakpointID: 6, Text: "Catchpoint 6 (exception thrown)"},
+		},
+		{
+			"exited normally",
+			[]string{"[Inferior 1 (process 42) exited normally]"},
+			"stopping", "ok", &dbgp.Message{ExitCode: &zero, Text: "Inferior 1 (process 42) exited normally"},
+		},
+		{
+			"exit code in octal",
+			[]string{"[Inferior 1 (process 42) exited with code 03]"},
+			"stopping", "ok", &dbgp.Message{ExitCode: &three, Text: "Inferior 1 (process 42) exited with code 03"},
+		},
+		{
+			"terminated",
+			[]string{"", "Program terminated with signal SIGKILL, Killed.", "The program no longer exists."},
+			"stopping", "exception", &dbgp.Message{Exception: "SIGKILL", Text: "SIGKILL: Killed"},
+		},
+		{
+			"not running",
+			[]string{"The program is not being run."},
+			"stopping", "error", &dbgp.Message{Text: "The program is not being run."},
+		},
+		{
+			"end of the recording",
+			[]string{"", "No more reverse-execution history.", "main () at /src/main.c:2"},
+			"break", "ok", &dbgp.Message{Text: "No more reverse-execution history", Filename: "/src/main.c", Lineno: 2},
+		},
+	}
+	for _, tt := range tests {
+		status, reason, msg := stopOf(tt.lines)
+		if status != tt.status || reason != tt.reason {
+			t.Errorf("%s: got %s/%s, want %s/%s", tt.name, status, reason, tt.status, tt.reason)
+		}
+		if !reflect.DeepEqual(msg, tt.msg) {
+			t.Errorf("%s: got message %+v, want %+v", tt.name, msg, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package gdbproxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"strconv"
+	"strings"
+)
+
+// watchCommands are the gdb commands setting watch breakpoints by type
+var watchCommands = map[string]string{
+	"watch":          "watch",
+	"x_read_watch":   "rwatch",
+	"x_access_watch": "awatch",
+}
+
+// WatchpointSet watches an expression with gdb's watch, rwatch or awatch.
+// gdb falls back to a software watchpoint for writes if the expression
+// cannot be watched in hardware, which is reported; reads and accesses
+// require hardware support. Watchpoints on locals are deleted by gdb when the
+// frame returns, which stops the program and is notified.
+func (g *GDB) WatchpointSet(ctx context.Context, bpType, expression string) (dbgp.Breakpoint, error) {
+	cmd, ok := watchCommands[bpType]
+	if !ok {
+		return dbgp.Breakpoint{}, dbgp.ErrBreakpointType
+	}
+	if err := g.checkExpression(expression); err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	lines, err := g.exec(ctx, cmd+" "+expression)
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	for _, l := range lines {
+		// Hardware read watchpoint 2: x
+		if m := watchRe.FindStringSubmatch(l); m != nil {
+			id, err := strconv.Atoi(m[2])
+			return dbgp.Breakpoint{ID: id, State: "enabled", Hardware: m[1] != "W"}, err
+		}
+	}
+	return dbgp.Breakpoint{}, fmt.Errorf("%s", strings.Join(lines, " "))
+}
+
+// Notifications returns the messages logged by logpoints and the watchpoints
+// deleted by gdb since the last call
+func (g *GDB) Notifications() []dbgp.Notification {
+	notes := g.notes
+	g.notes = nil
+	return notes
+}
+
+// deletedWatchpoints returns notifications of the watchpoints gdb deleted
+// when their expression went out of scope
+func deletedWatchpoints(lines []string) []dbgp.Notification {
+	var notes []dbgp.Notification
+	for _, l := range lines {
+		if m := scopeRe.FindStringSubmatch(l); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			notes = append(notes, dbgp.Notification{Name: "x_breakpoint_deleted", BreakpointID: id, Text: scopeText(m[1])})
+		}
+	}
+	return notes
+}
+
+// scopeText describes a watchpoint deleted when leaving its scope, which gdb
+// prints across two lines
+func scopeText(id string) string {
+	return "Watchpoint " + id + " deleted because the program has left the block in which its expression is valid"
+}
@@ -0,0 +1,613 @@
+package dbgp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/traviscline/dbgp/wire"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultHandlers returns the built-in commands supported by client
+func defaultHandlers(client DBGPClient) map[string]CommandHandler {
+	h := map[string]CommandHandler{
+		"status":      handleStatus,
+		"break":       handleBreak,
+		"feature_get": handleFeatureGet,
+		"feature_set": handleFeatureSet,
+		"source":      handleSource,
+	}
+	if _, ok := client.(Stepper); ok {
+		h["step_into"] = continuation(func(ctx context.Context, c DBGPClient) (string, string, error) {
+			return c.(Stepper).StepInto(ctx)
+		})
+		h["step_over"] = continuation(func(ctx context.Context, c DBGPClient) (string, string, error) {
+			return c.(Stepper).StepOver(ctx)
+		})
+	}
+	if _, ok := client.(Runner); ok {
+		h["run"] = continuation(func(ctx context.Context, c DBGPClient) (string, string, error) {
+			return c.(Runner).Run(ctx)
+		})
+	}
+	if _, ok := client.(StackInspector); ok {
+		h["stack_depth"] = handleStackDepth
+		h["stack_get"] = handleStackGet
+	}
+	if _, ok := client.(Evaluator); ok {
+		h["context_names"] = handleContextNames
+		h["context_get"] = handleContextGet
+		h["property_get"] = handlePropertyGet
+	}
+	if _, ok := client.(PropertySetter); ok {
+		h["property_set"] = handlePropertySet
+	}
+	_, lines := client.(BreakpointManager)
+	_, exceptions := client.(ExceptionBreakpointSetter)
+	_, watches := client.(WatchpointSetter)
+	if lines || exceptions || watches {
+		h["breakpoint_set"] = handleBreakpointSet
+		h["breakpoint_get"] = handleBreakpointGet
+		h["breakpoint_list"] = handleBreakpointList
+	}
+	if _, ok := client.(BreakpointRemover); ok {
+		h["breakpoint_remove"] = handleBreakpointRemove
+	}
+	if _, ok := client.(StreamRedirector); ok {
+		h["stdout"] = handleStream
+		h["stderr"] = handleStream
+	}
+	if _, ok := client.(ThreadLister); ok {
+		h["x_thread_list"] = handleThreadList
+		h["x_thread_select"] = handleThreadSelect
+	}
+	if _, ok := client.(MemoryReader); ok {
+		h["x_memory_read"] = handleMemoryRead
+	}
+	if _, ok := client.(Disassembler); ok {
+		h["x_disasm"] = handleDisasm
+		h["x_step_into_instruction"] = continuation(func(ctx context.Context, c DBGPClient) (string, string, error) {
+			return c.(Disassembler).StepIntoInstruction(ctx)
+		})
+		h["x_step_over_instruction"] = continuation(func(ctx context.Context, c DBGPClient) (string, string, error) {
+			return c.(Disassembler).StepOverInstruction(ctx)
+		})
+	}
+	if _, ok := client.(ReverseExecutor); ok {
+		h["x_step_into_back"] = continuation(func(ctx context.Context, c DBGPClient) (string, string, error) {
+			return c.(ReverseExecutor).StepIntoBack(ctx)
+		})
+		h["x_step_over_back"] = continuation(func(ctx context.Context, c DBGPClient) (string, string, error) {
+			return c.(ReverseExecutor).StepOverBack(ctx)
+		})
+		h["x_step_out_back"] = continuation(func(ctx context.Context, c DBGPClient) (string, string, error) {
+			return c.(ReverseExecutor).StepOutBack(ctx)
+		})
+		h["x_run_back"] = continuation(func(ctx context.Context, c DBGPClient) (string, string, error) {
+			return c.(ReverseExecutor).RunBack(ctx)
+		})
+	}
+	return h
+}
+
+func handleUnimplemented(c *Conn, r *Request) (*Response, error) {
+	return nil, ErrUnimplemented
+}
+
+func handleStatus(c *Conn, r *Request) (*Response, error) {
+	status, err := c.client.Status(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Attrs: map[string]interface{}{"status": status, "reason": "ok"}}, nil
+}
+
+// handleBreak answers a break with nothing to interrupt; break during a
+// continuation is handled by Conn
+func handleBreak(c *Conn, r *Request) (*Response, error) {
+	return &Response{Attrs: map[string]interface{}{"success": 0}}, nil
+}
+
+// handleFeatureGet reports the features of the client and the registered
+// commands as supported
+func handleFeatureGet(c *Conn, r *Request) (*Response, error) {
+	name := r.Option("n")
+	resp := &Response{Attrs: map[string]interface{}{"feature_name": name, "supported": 0}}
+	if _, ok := c.handlers[name]; ok {
+		resp.Attrs["supported"] = 1
+	}
+	if name == "notify_ok" {
+		resp.Attrs["supported"] = 1
+		resp.Payload, resp.Raw = boolInt(c.notify), true
+		return resp, nil
+	}
+	fr, ok := c.client.(FeatureReporter)
+	if !ok {
+		return resp, nil
+	}
+	if v, err := getFieldValueByName(fr.Features(), strings.Title(name)); err == nil {
+		resp.Attrs["supported"] = 1
+		resp.Payload = escapeText(fmt.Sprint(v))
+		resp.Raw = true
+	}
+	return resp, nil
+}
+
+// handleFeatureSet sets the features negotiated by the IDE, of which only
+// notify_ok is supported
+func handleFeatureSet(c *Conn, r *Request) (*Response, error) {
+	name := r.Option("n")
+	resp := &Response{Attrs: map[string]interface{}{"feature": name, "success": 0}}
+	if name != "notify_ok" {
+		return resp, nil
+	}
+	v, err := r.IntOption("v", -1)
+	if err != nil || v < 0 || v > 1 {
+		return nil, ErrInvalidOpts
+	}
+	c.notify = v == 1
+	resp.Attrs["success"] = 1
+	return resp, nil
+}
+
+// continuation returns the handler of a command resuming the program. Hits
+// of breakpoints are counted; run resumes the program until one meets its
+// hit condition, while steps stop at breakpoints regardless.
+func continuation(step func(context.Context, DBGPClient) (status, reason string, err error)) CommandHandler {
+	return func(c *Conn, r *Request) (*Response, error) {
+		for {
+			status, reason, err := step(r.Context(), c.client)
+			if err != nil {
+				return nil, err
+			}
+			if !c.hit(r.Context(), status) && r.Command == "run" {
+				continue
+			}
+			attrs := map[string]interface{}{"status": status, "reason": reason}
+			return &Response{Attrs: attrs, Payload: c.lastStop(attrs)}, nil
+		}
+	}
+}
+
+func handleStackDepth(c *Conn, r *Request) (*Response, error) {
+	si, ok := c.client.(StackInspector)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	depth, err := si.StackDepth(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Attrs: map[string]interface{}{"depth": depth}}, nil
+}
+
+func handleStackGet(c *Conn, r *Request) (*Response, error) {
+	si, ok := c.client.(StackInspector)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	depth, err := r.IntOption("d", 0)
+	if err != nil {
+		return nil, err
+	}
+	stackEntries, err := si.StackGet(r.Context(), depth)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := make([]stack, len(stackEntries))
+	for i, se := range stackEntries {
+		se.Filename = c.Paths.ToIDE(se.Filename)
+		wrapped[i] = stack{se}
+	}
+	return &Response{Payload: wrapped}, nil
+}
+
+func handleContextNames(c *Conn, r *Request) (*Response, error) {
+	e, ok := c.client.(Evaluator)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	depth, err := r.IntOption("d", 0)
+	if err != nil {
+		return nil, err
+	}
+	contexts, err := e.ContextNames(r.Context(), depth)
+	return &Response{Payload: contexts}, err
+}
+
+func handleContextGet(c *Conn, r *Request) (*Response, error) {
+	e, ok := c.client.(Evaluator)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	depth, context, err := depthAndContext(r)
+	if err != nil {
+		return nil, err
+	}
+	properties, err := e.ContextGet(r.Context(), depth, context)
+	return &Response{Attrs: map[string]interface{}{"context": context}, Payload: properties}, err
+}
+
+func handlePropertyGet(c *Conn, r *Request) (*Response, error) {
+	e, ok := c.client.(Evaluator)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	depth, context, err := depthAndContext(r)
+	if err != nil {
+		return nil, err
+	}
+	property, err := e.PropertyGet(r.Context(), depth, context, r.Option("n"))
+	return &Response{Payload: property}, err
+}
+
+// handlePropertySet sets a property to the base64 encoded value after --
+func handlePropertySet(c *Conn, r *Request) (*Response, error) {
+	ps, ok := c.client.(PropertySetter)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	depth, context, err := depthAndContext(r)
+	if err != nil {
+		return nil, err
+	}
+	value, err := base64.StdEncoding.DecodeString(r.Data)
+	if err != nil || r.Option("n") == "" {
+		return nil, ErrInvalidOpts
+	}
+	if err := ps.PropertySet(r.Context(), depth, context, r.Option("n"), string(value)); err != nil {
+		return nil, err
+	}
+	return &Response{Attrs: map[string]interface{}{"success": 1}}, nil
+}
+
+// depthAndContext returns the -d and -c options
+func depthAndContext(r *Request) (depth, context int, err error) {
+	if depth, err = r.IntOption("d", 0); err != nil {
+		return 0, 0, err
+	}
+	context, err = r.IntOption("c", 0)
+	return depth, context, err
+}
+
+// handleBreakpointSet sets a breakpoint of any supported type
+func handleBreakpointSet(c *Conn, r *Request) (*Response, error) {
+	var (
+		bp  Breakpoint
+		err error
+	)
+	hitValue, err := r.IntOption("h", 0)
+	if err != nil || hitValue < 0 {
+		return nil, ErrInvalidOpts
+	}
+	hitCondition := r.Option("o")
+	switch hitCondition {
+	case "", ">=", "==", "%":
+	default:
+		return nil, ErrInvalidOpts
+	}
+	if hitValue > 0 {
+		_, counts := c.client.(StopReporter)
+		if _, native := c.client.(HitConditionSetter); !counts && !native {
+			// the hits could neither be evaluated by the client nor counted
+			return nil, ErrInvalidOpts
+		}
+	}
+	t := r.Option("t")
+	switch t {
+	case "exception":
+		eb, ok := c.client.(ExceptionBreakpointSetter)
+		if !ok {
+			return nil, ErrBreakpointType
+		}
+		if r.Option("x") == "" {
+			return nil, ErrInvalidOpts
+		}
+		bp, err = eb.ExceptionBreakpointSet(r.Context(), r.Option("x"))
+	case "watch", "x_read_watch", "x_access_watch":
+		ws, ok := c.client.(WatchpointSetter)
+		if !ok {
+			return nil, ErrBreakpointType
+		}
+		expr, derr := base64.StdEncoding.DecodeString(r.Data)
+		if derr != nil || len(expr) == 0 {
+			return nil, ErrInvalidOpts
+		}
+		bp, err = ws.WatchpointSet(r.Context(), t, string(expr))
+		bp.Expression = string(expr)
+	default:
+		lineNumber, lerr := strconv.Atoi(r.Option("n"))
+		if lerr != nil {
+			return nil, ErrInvalidOpts
+		}
+		fn, perr := c.Paths.ToEngine(r.Option("f"))
+		if perr != nil {
+			return nil, perr
+		}
+		if t == "x_log" {
+			message, derr := base64.StdEncoding.DecodeString(r.Data)
+			if derr != nil || len(message) == 0 {
+				return nil, ErrInvalidOpts
+			}
+			bp, err = c.setLogpoint(r.Context(), fn, lineNumber, string(message))
+		} else {
+			bm, ok := c.client.(BreakpointManager)
+			if !ok {
+				return nil, ErrBreakpointType
+			}
+			bp, err = bm.BreakpointSet(r.Context(), t, fn, lineNumber)
+		}
+		bp.Filename, bp.Lineno = r.Option("f"), lineNumber
+	}
+	if err != nil {
+		return nil, err
+	}
+	bp.Type, bp.Exception = t, r.Option("x")
+	bp.HitValue, bp.HitCondition, bp.HitCount = hitValue, hitCondition, 0
+	if err := c.addBreakpoint(r.Context(), &bp); err != nil {
+		return nil, err
+	}
+	attrs := map[string]interface{}{"id": bp.ID, "state": bp.State}
+	if bp.Expression != "" {
+		// watch breakpoints
+		attrs["x_hardware"] = boolInt(bp.Hardware)
+	}
+	return &Response{Attrs: attrs}, nil
+}
+
+// handleBreakpointGet returns a breakpoint set by the IDE
+func handleBreakpointGet(c *Conn, r *Request) (*Response, error) {
+	id, err := r.IntOption("d", 0)
+	if err != nil {
+		return nil, err
+	}
+	bp, ok := c.breakpoints[id]
+	if !ok {
+		return nil, ErrNoBreakpoint
+	}
+	return &Response{Payload: breakpoint{Breakpoint: *bp}}, nil
+}
+
+// handleBreakpointRemove removes a breakpoint set by the IDE, answering with
+// the removed breakpoint
+func handleBreakpointRemove(c *Conn, r *Request) (*Response, error) {
+	id, err := r.IntOption("d", 0)
+	if err != nil {
+		return nil, err
+	}
+	bp, ok := c.breakpoints[id]
+	if !ok {
+		return nil, ErrNoBreakpoint
+	}
+	if err := c.client.(BreakpointRemover).BreakpointRemove(r.Context(), id); err != nil {
+		return nil, err
+	}
+	c.forgetBreakpoint(id)
+	return &Response{Payload: breakpoint{Breakpoint: *bp}}, nil
+}
+
+// handleBreakpointList returns the breakpoints set by the IDE
+func handleBreakpointList(c *Conn, r *Request) (*Response, error) {
+	ids := make([]int, 0, len(c.breakpoints))
+	for id := range c.breakpoints {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	list := make([]breakpoint, len(ids))
+	for i, id := range ids {
+		list[i] = breakpoint{Breakpoint: *c.breakpoints[id]}
+	}
+	return &Response{Payload: list}, nil
+}
+
+// handleSource returns the contents of a file, or the disassembly of a
+// function for DisasmURIPrefix URIs
+func handleSource(c *Conn, r *Request) (*Response, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if name := r.Option("f"); strings.HasPrefix(name, DisasmURIPrefix) {
+		b, err = c.disasmSource(r.Context(), strings.TrimPrefix(name, DisasmURIPrefix))
+	} else {
+		b, err = c.readSource(r.Context(), name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Attrs:   map[string]interface{}{"encoding": "base64"},
+		Payload: "<![CDATA[" + base64.StdEncoding.EncodeToString(b) + "]]>",
+		Raw:     true,
+	}, nil
+}
+
+// readSource reads a file named by the IDE from the client, or the local
+// filesystem if it is no SourceProvider
+func (c *Conn) readSource(ctx context.Context, name string) ([]byte, error) {
+	fn, err := c.Paths.ToEngine(name)
+	if err != nil {
+		return nil, err
+	}
+	if sp, ok := c.client.(SourceProvider); ok {
+		b, err := sp.Source(ctx, fn)
+		if err != nil {
+			glog.V(2).Infoln("error reading source:", fn, err)
+			return nil, ErrCantOpenFile
+		}
+		return b, nil
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		glog.V(2).Infoln("error opening file:", fn, err)
+		return nil, ErrCantOpenFile
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		glog.V(2).Infoln("error reading file:", err)
+		return nil, ErrCantOpenFile
+	}
+	return b, nil
+}
+
+// disasmSource returns the disassembly of a function as source
+func (c *Conn) disasmSource(ctx context.Context, function string) ([]byte, error) {
+	d, ok := c.client.(Disassembler)
+	if !ok {
+		return nil, ErrCantOpenFile
+	}
+	instructions, err := d.Disassemble(ctx, function)
+	if err != nil {
+		glog.V(2).Infoln("error disassembling:", function, err)
+		return nil, ErrCantOpenFile
+	}
+	var b []byte
+	for _, i := range instructions {
+		b = append(b, i.String()+"\n"...)
+	}
+	return b, nil
+}
+
+// handleStream redirects stdout or stderr, -c being 0 (disable), 1 (copy) or
+// 2 (redirect)
+func handleStream(c *Conn, r *Request) (*Response, error) {
+	sr, ok := c.client.(StreamRedirector)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	mode, err := r.IntOption("c", -1)
+	if err != nil || mode < 0 || mode > 2 {
+		return nil, ErrInvalidOpts
+	}
+	if err := sr.RedirectStream(r.Context(), r.Command, mode, streamWriter{c, r.Command}); err != nil {
+		return nil, err
+	}
+	return &Response{Attrs: map[string]interface{}{"success": 1}}, nil
+}
+
+// streamWriter sends what is written as stream packets
+type streamWriter struct {
+	c          *Conn
+	streamType string
+}
+
+func (w streamWriter) Write(b []byte) (int, error) {
+	p := fmt.Sprintf(`<stream xmlns="%s" type="%s" encoding="base64">%s</stream>`,
+		wire.Namespace, w.streamType, base64.StdEncoding.EncodeToString(b))
+	if err := w.c.writePacket([]byte(p)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func handleThreadList(c *Conn, r *Request) (*Response, error) {
+	tl, ok := c.client.(ThreadLister)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	threads, err := tl.Threads(r.Context())
+	return &Response{Payload: threads}, err
+}
+
+func handleThreadSelect(c *Conn, r *Request) (*Response, error) {
+	tl, ok := c.client.(ThreadLister)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	id, err := strconv.Atoi(r.Option("n"))
+	if err != nil {
+		return nil, ErrInvalidOpts
+	}
+	return nil, tl.SelectThread(r.Context(), id)
+}
+
+func handleMemoryRead(c *Conn, r *Request) (*Response, error) {
+	mr, ok := c.client.(MemoryReader)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	address, size, err := c.memoryRange(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err := mr.ReadMemory(r.Context(), address, size)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Attrs: map[string]interface{}{
+			"address":  fmt.Sprintf("0x%x", address),
+			"size":     len(b),
+			"encoding": "base64",
+		},
+		Payload: base64.StdEncoding.EncodeToString(b),
+		Raw:     true,
+	}, nil
+}
+
+// memoryRange parses the -a address, decimal or 0x prefixed hex, and -s size
+// of a memory command
+func (c *Conn) memoryRange(r *Request) (address uint64, size int, err error) {
+	max := c.MaxMemoryRead
+	if max == 0 {
+		max = DefaultMaxMemoryRead
+	}
+	address, err = strconv.ParseUint(r.Option("a"), 0, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidOpts
+	}
+	size, err = strconv.Atoi(r.Option("s"))
+	if err != nil || size <= 0 || size > max {
+		return 0, 0, ErrInvalidOpts
+	}
+	return address, size, nil
+}
+
+func handleDisasm(c *Conn, r *Request) (*Response, error) {
+	d, ok := c.client.(Disassembler)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	instructions, err := d.Disassemble(r.Context(), r.Option("n"))
+	return &Response{Payload: instructions}, err
+}
+
+// lastStop returns the xdebug:message element describing the last stop, if
+// the client reports one
+func (c *Conn) lastStop(attrs map[string]interface{}) interface{} {
+	sr, ok := c.client.(StopReporter)
+	if !ok {
+		return nil
+	}
+	m := sr.LastStop()
+	if m == nil {
+		return nil
+	}
+	msg := *m
+	if msg.Filename != "" {
+		msg.Filename = c.Paths.ToIDE(msg.Filename)
+	}
+	attrs["xmlns:xdebug"] = xdebugNamespace
+	return xdebugMessage{Message: msg}
+}
+
+type xdebugMessage struct {
+	XMLName xml.Name `xml:"xdebug:message"`
+	Message
+}
+
+type breakpoint struct {
+	XMLName xml.Name `xml:"breakpoint"`
+	Breakpoint
+}
+
+type stack struct {
+	Stack
+}
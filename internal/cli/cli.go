@@ -0,0 +1,112 @@
+// Package cli holds the flags and setup shared by the commands connecting a
+// debugger to the IDE: gdb2dbgp, dlv2dbgp, lldb2dbgp and dap2dbgp
+package cli
+
+import (
+	"flag"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/internal/launch"
+	"github.com/traviscline/dbgp/record"
+	"github.com/traviscline/dbgp/transport"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// Engine is the configuration of the connection to the IDE
+type Engine struct {
+	dial, listen *string
+	secretFile   *string
+	recordFile   *string
+	tls          *transport.Config
+	paths        dbgp.PathMap
+}
+
+// EngineFlags registers -dial, -listen, -secret-file, -record, -map and the
+// -tls flags on fs, returning the Engine they configure
+func EngineFlags(fs *flag.FlagSet) *Engine {
+	e := &Engine{
+		dial:       fs.String("dial", "localhost:9000", "DBGP host/port to connect to"),
+		listen:     fs.String("listen", "", "accept a single IDE connection on this host/port instead of dialing"),
+		secretFile: fs.String("secret-file", "", "file holding the secret the IDE must authenticate with (default $DBGP_SECRET)"),
+		recordFile: fs.String("record", "", "file to record the DBGP session to, for replay with dbgpreplay"),
+		tls:        transport.Flags(fs),
+	}
+	fs.Var(&e.paths, "map", "path mapping of the form ide_path=engine_path (repeatable)")
+	return e
+}
+
+// Secret returns the secret the IDE must authenticate with, read from
+// -secret-file or $DBGP_SECRET
+func (e *Engine) Secret() (string, error) {
+	if *e.secretFile == "" {
+		return os.Getenv("DBGP_SECRET"), nil
+	}
+	b, err := ioutil.ReadFile(*e.secretFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Connect dials the IDE or, with -listen, waits for it to connect. With
+// -record the session is recorded.
+func (e *Engine) Connect() (io.ReadWriter, error) {
+	c, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	if *e.recordFile == "" {
+		return c, nil
+	}
+	f, err := os.Create(*e.recordFile)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return record.NewRecorder(c, f), nil
+}
+
+func (e *Engine) connect() (net.Conn, error) {
+	if *e.listen == "" {
+		log.Println("dialing", *e.dial)
+		return transport.Dial(*e.dial, e.tls)
+	}
+	l, err := transport.Listen(*e.listen, e.tls)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	log.Println("listening on", l.Addr())
+	return l.Accept()
+}
+
+// NewConn creates a Conn serving client over rw with the path mappings and
+// the secret
+func (e *Engine) NewConn(rw io.ReadWriter, client dbgp.DBGPClient, secret string) *dbgp.Conn {
+	conn := dbgp.NewConn(rw, client)
+	conn.Paths = e.paths
+	conn.Secret = secret
+	return conn
+}
+
+// LaunchFlags registers -cwd, -stdin, -stdout, -stderr and -env on fs,
+// returning the launch options they set
+func LaunchFlags(fs *flag.FlagSet) *launch.Options {
+	o := new(launch.Options)
+	fs.StringVar(&o.Dir, "cwd", "", "working directory for the target")
+	fs.StringVar(&o.Stdin, "stdin", "", "file to redirect the target's stdin from")
+	fs.StringVar(&o.Stdout, "stdout", "", "file to redirect the target's stdout to")
+	fs.StringVar(&o.Stderr, "stderr", "", "file to redirect the target's stderr to")
+	fs.Var((*StringList)(&o.Env), "env", "environment variable KEY=VAL for the target (repeatable)")
+	return o
+}
+
+// StringList is a repeatable string flag
+type StringList []string
+
+func (l *StringList) String() string     { return strings.Join(*l, ",") }
+func (l *StringList) Set(s string) error { *l = append(*l, s); return nil }
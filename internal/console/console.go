@@ -0,0 +1,213 @@
+// Package console drives a line oriented, interactive debugger (gdb, lldb)
+// over its stdin and stdout pipes
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/golang/glog"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// InterruptGrace is how long Command waits for the prompt after interrupting
+// the debugger
+var InterruptGrace = 5 * time.Second
+
+// promptToken is sent on the output channels in place of a prompt
+const promptToken = "\x00prompt"
+
+// Console is a running debugger process
+type Console struct {
+	prompt string // stripped from the beginning of output lines
+	name   string // used in logs
+
+	cmd *exec.Cmd
+
+	stdout, stderr <-chan string
+	stdin          chan<- string
+
+	errChan chan error
+}
+
+// Start runs cmd, which must not have its stdio set up yet. prompt is the
+// debugger's prompt, such as "(gdb) ".
+func Start(cmd *exec.Cmd, prompt string) (*Console, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	// start io goroutines
+	errChan := make(chan error)
+	c := &Console{
+		prompt:  prompt,
+		name:    strings.TrimSpace(prompt),
+		cmd:     cmd,
+		errChan: errChan,
+	}
+	c.stdout = c.scanReaderToChan(stdout, true)
+	c.stderr = c.scanReaderToChan(stderr, false)
+	c.stdin = c.stringChanToWriter(stdin)
+	return c, nil
+}
+
+// Cmd returns the underlying debugger process
+func (c *Console) Cmd() *exec.Cmd {
+	return c.cmd
+}
+
+// Send writes a command line to the debugger without waiting for output
+func (c *Console) Send(line string) {
+	c.stdin <- line
+}
+
+// Command sends a command line and returns its output, including stderr,
+// once the debugger prints its prompt again. When ctx is done first, the
+// debugger is interrupted and the output up to the following prompt is
+// returned along with ctx's error.
+func (c *Console) Command(ctx context.Context, line string) ([]string, error) {
+	c.Send(line)
+	return c.WaitPrompt(ctx)
+}
+
+// WaitPrompt returns the output up to the next prompt, interrupting the
+// debugger when ctx is done first
+func (c *Console) WaitPrompt(ctx context.Context) ([]string, error) {
+	lines, prompted, err := c.untilPrompt(ctx.Done())
+	if err != nil || prompted {
+		return lines, err
+	}
+	glog.V(1).Infoln(c.name, "interrupting:", ctx.Err())
+	if err := c.Interrupt(); err != nil {
+		return lines, err
+	}
+	grace, cancel := context.WithTimeout(context.Background(), InterruptGrace)
+	defer cancel()
+	more, _, err := c.untilPrompt(grace.Done())
+	if err == nil {
+		err = ctx.Err()
+	}
+	return append(lines, more...), err
+}
+
+// untilPrompt collects output until the prompt, or until done
+func (c *Console) untilPrompt(done <-chan struct{}) (result []string, prompted bool, err error) {
+	stderr := c.stderr
+	for {
+		select {
+		case line, ok := <-c.stdout:
+			if !ok {
+				return result, false, io.EOF
+			}
+			if line == promptToken {
+				return result, true, nil
+			}
+			result = append(result, line)
+			glog.V(2).Infoln(c.name, line)
+		case line, ok := <-stderr:
+			if !ok {
+				// closed, stop selecting it
+				stderr = nil
+				continue
+			}
+			result = append(result, line)
+			glog.V(2).Infoln(c.name, "stderr:", line)
+		case err := <-c.errChan:
+			glog.Warningln("error while consuming:", err)
+		case <-done:
+			return result, false, nil
+		}
+	}
+}
+
+// Interrupt sends SIGINT to the debugger, which stops the debugged program
+func (c *Console) Interrupt() error {
+	return c.cmd.Process.Signal(os.Interrupt)
+}
+
+// Consumes the reader and generates a string for every newline read and, if
+// prompts is set, promptToken for every prompt. The channel is closed at EOF.
+func (c *Console) scanReaderToChan(r io.Reader, prompts bool) <-chan string {
+	ch := make(chan string)
+	scanner := bufio.NewScanner(r)
+	if prompts {
+		scanner.Split(c.splitPrompts)
+	}
+	go func() {
+		defer close(ch)
+		for scanner.Scan() {
+			ch <- scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			c.errChan <- err
+		}
+	}()
+	return ch
+}
+
+// splitPrompts splits lines like bufio.ScanLines, but also splits off a
+// prompt at the beginning of a line, which is not followed by a newline
+func (c *Console) splitPrompts(data []byte, atEOF bool) (int, []byte, error) {
+	prompt := []byte(c.prompt)
+	if bytes.HasPrefix(data, prompt) {
+		return len(prompt), []byte(promptToken), nil
+	}
+	if !atEOF && len(data) < len(prompt) && bytes.HasPrefix(prompt, data) {
+		// possibly an incomplete prompt
+		return 0, nil, nil
+	}
+	return bufio.ScanLines(data, atEOF)
+}
+
+// Provides a writable channel of strings as the interface to a writer. Newlines
+// are automatically appended
+func (c *Console) stringChanToWriter(w io.Writer) chan<- string {
+	ch := make(chan string)
+	bw := bufio.NewWriter(w)
+	go func() {
+		for {
+			s := <-ch
+			_, err := bw.WriteString(s)
+			if err != nil {
+				c.errChan <- err
+			}
+			_, err = bw.WriteString("\n")
+			if err != nil {
+				c.errChan <- err
+			}
+			glog.V(1).Infoln(c.name, s)
+			bw.Flush()
+		}
+	}()
+	return ch
+}
+
+// Extract extracts the specified matchGroups from target based on regex
+func Extract(regex, target string, matchGroup ...int) ([]string, error) {
+	results := make([]string, 0)
+	matches := regexp.MustCompile(regex).FindStringSubmatch(target)
+	for _, mg := range matchGroup {
+		if mg > len(matches)-1 {
+			return nil, fmt.Errorf("not enough matches")
+		}
+		results = append(results, matches[mg])
+	}
+	return results, nil
+}
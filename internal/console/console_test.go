@@ -0,0 +1,52 @@
+package console
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCommand(t *testing.T) {
+	// a shell prompting like a debugger, closing stderr right away
+	cmd := exec.Command("sh", "-c", `exec 2>&-; printf '> '; while read l; do echo "$l"; printf '> '; done`)
+	c, err := Start(cmd, "> ")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer cmd.Process.Kill()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.WaitPrompt(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"one", "two"} {
+		lines, err := c.Command(ctx, line)
+		if err != nil || !reflect.DeepEqual(lines, []string{line}) {
+			t.Errorf("Command(%q) = %q, %v", line, lines, err)
+		}
+	}
+}
+
+func TestSplitPrompts(t *testing.T) {
+	c := &Console{prompt: "(gdb) "}
+	tests := []struct {
+		data    string
+		atEOF   bool
+		advance int
+		token   string
+	}{
+		{"(gdb) ", false, 6, promptToken},
+		{"(gd", false, 0, ""},
+		{"line\n(gdb) ", false, 5, "line"},
+		{"partial", false, 0, ""},
+		{"partial", true, 7, "partial"},
+	}
+	for _, tt := range tests {
+		advance, token, err := c.splitPrompts([]byte(tt.data), tt.atEOF)
+		if err != nil || advance != tt.advance || string(token) != tt.token {
+			t.Errorf("splitPrompts(%q, %v) = %d, %q, %v, want %d, %q", tt.data, tt.atEOF, advance, token, err, tt.advance, tt.token)
+		}
+	}
+}
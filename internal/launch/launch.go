@@ -0,0 +1,65 @@
+// Package launch holds the options of how the debugged program is started,
+// shared by the backends running it under a debugger: gdbproxy, lldbproxy and
+// delveproxy
+package launch
+
+import (
+	"fmt"
+	"github.com/traviscline/dbgp/internal/policy"
+	"strings"
+)
+
+// Options describe how the debugged program is started
+type Options struct {
+	Args                  []string
+	Env                   []string // KEY=VAL
+	Dir                   string
+	Stdin, Stdout, Stderr string // files to redirect to, if set
+}
+
+// Option configures how the debugged program is started
+type Option func(*Options)
+
+// WithArgs sets the arguments passed to the target program
+func WithArgs(args ...string) Option {
+	return func(o *Options) { o.Args = append(o.Args, args...) }
+}
+
+// WithEnv sets environment variables ("KEY=VAL") for the target program
+func WithEnv(env ...string) Option {
+	return func(o *Options) { o.Env = append(o.Env, env...) }
+}
+
+// WithDir sets the working directory of the target program
+func WithDir(dir string) Option {
+	return func(o *Options) { o.Dir = dir }
+}
+
+// WithStdio redirects the target program's stdin, stdout and stderr to the
+// named files. Empty names are left untouched.
+func WithStdio(stdin, stdout, stderr string) Option {
+	return func(o *Options) { o.Stdin, o.Stdout, o.Stderr = stdin, stdout, stderr }
+}
+
+// Apply returns the Options set by opts
+func Apply(opts ...Option) Options {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Check rejects environment variables not of the form KEY=VAL and control
+// characters, which would end the command lines of a debugger
+func (o *Options) Check() error {
+	for _, kv := range o.Env {
+		if !strings.Contains(kv, "=") || policy.HasControl(kv) {
+			return fmt.Errorf("invalid environment variable %q, expected KEY=VAL", kv)
+		}
+	}
+	if policy.HasControl(o.Dir + o.Stdin + o.Stdout + o.Stderr) {
+		return fmt.Errorf("control characters in directory or redirections")
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package launch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	got := Apply(
+		WithArgs("a", "b"),
+		WithArgs("c"),
+		WithEnv("K=V"),
+		WithDir("/tmp"),
+		WithStdio("in", "", "err"),
+	)
+	want := Options{Args: []string{"a", "b", "c"}, Env: []string{"K=V"}, Dir: "/tmp", Stdin: "in", Stderr: "err"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, tt := range []struct {
+		o  Options
+		ok bool
+	}{
+		{Options{}, true},
+		{Options{Env: []string{"K=V", "EMPTY="}, Dir: "/my dir", Stdout: "out.txt"}, true},
+		{Options{Env: []string{"K"}}, false},
+		{Options{Env: []string{"K=V\nshell ls"}}, false},
+		{Options{Dir: "/tmp\n"}, false},
+		{Options{Stdin: "in\x00"}, false},
+	} {
+		if err := tt.o.Check(); (err == nil) != tt.ok {
+			t.Errorf("%+v: got %v, want ok %v", tt.o, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package policy restricts the command lines sent to a debugger driven
+// through its command interpreter (gdb, lldb). The IDE controls every string
+// in DBGP commands, while debuggers can run shell commands and scripts, so
+// every line passes an allowlist of commands and IDE supplied names are
+// validated before they are interpolated.
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Policy decides which command lines may be sent to a debugger
+type Policy struct {
+	debugger   string          // named in errors
+	allowed    map[string]bool // commands and "command subcommand" pairs
+	restricted map[string]bool // commands only allowed with an allowed subcommand
+	aliases    map[string]string
+}
+
+// New creates a policy allowing commands, and the restricted commands that
+// are keys of subcommands only with the listed subcommands. Aliases are
+// resolved before checking. extra adds commands or "command subcommand"
+// pairs.
+func New(debugger string, commands []string, subcommands map[string][]string, aliases map[string]string, extra []string) *Policy {
+	p := &Policy{
+		debugger:   debugger,
+		allowed:    make(map[string]bool),
+		restricted: make(map[string]bool),
+		aliases:    aliases,
+	}
+	for _, c := range commands {
+		p.allowed[c] = true
+	}
+	for c, subs := range subcommands {
+		p.restricted[c] = true
+		for _, s := range subs {
+			p.allowed[c+" "+s] = true
+		}
+	}
+	for _, c := range extra {
+		p.allowed[strings.Join(strings.Fields(c), " ")] = true
+	}
+	return p
+}
+
+// Check returns an error unless line is a single, allowed command
+func (p *Policy) Check(line string) error {
+	if HasControl(line) {
+		return fmt.Errorf("%s command %q contains control characters", p.debugger, line)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return fmt.Errorf("empty %s command", p.debugger)
+	}
+	cmd := CommandName(line, p.aliases)
+	if !p.allowed[cmd] && !p.restricted[cmd] {
+		return fmt.Errorf("%s command %q is not allowed", p.debugger, cmd)
+	}
+	if p.restricted[cmd] {
+		if len(fields) < 2 {
+			fields = append(fields, "")
+		}
+		if !p.allowed[cmd+" "+fields[1]] {
+			return fmt.Errorf("%s command %q is not allowed", p.debugger, strings.Join(fields[:2], " "))
+		}
+	}
+	return nil
+}
+
+// CommandName returns the command of a command line, resolving aliases
+func CommandName(line string, aliases map[string]string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	if a, ok := aliases[fields[0]]; ok {
+		return a
+	}
+	return fields[0]
+}
+
+// variableRe matches references to variables and their members and elements,
+// such as *p, a.b, a->b[3] or a[i]
+var variableRe = regexp.MustCompile(`^[*&]*[A-Za-z_][A-Za-z0-9_]*` +
+	`(\.[A-Za-z_][A-Za-z0-9_]*|->[A-Za-z_][A-Za-z0-9_]*|\[([0-9]+|[A-Za-z_][A-Za-z0-9_]*)\])*$`)
+
+// IsVariable reports whether s is a plain reference to a variable, its
+// members or elements, which cannot call functions of the program
+func IsVariable(s string) bool {
+	return variableRe.MatchString(s)
+}
+
+// HasControl reports whether s contains characters that could end a command
+// line
+func HasControl(s string) bool {
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package policy
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	p := New("dbg", []string{"run", "set"}, map[string][]string{"set": {"var"}, "frame": {"select"}, "info": nil},
+		map[string]string{"r": "run"}, []string{"info  frame", "set print"})
+	tests := []struct {
+		line string
+		ok   bool
+	}{
+		{"run", true},
+		{"r", true},
+		{"  run  ", true},
+		{"set var x = 1", true},
+		{"set print pretty", true},
+		{"set logging on", false},
+		{"set", false},
+		{"frame select 1", true},
+		{"frame info", false},
+		{"info frame", true},
+		{"info", false},
+		{"shell rm -rf /", false},
+		{"", false},
+		{"run\nshell id", false},
+		{"run\x7f", false},
+	}
+	for _, tt := range tests {
+		if err := p.Check(tt.line); (err == nil) != tt.ok {
+			t.Errorf("Check(%q) = %v, want ok %v", tt.line, err, tt.ok)
+		}
+	}
+}
+
+func TestIsVariable(t *testing.T) {
+	tests := []struct {
+		s  string
+		ok bool
+	}{
+		{"x", true},
+		{"*p", true},
+		{"&a.b", true},
+		{"a->b[3]", true},
+		{"a[i].c", true},
+		{"f()", false},
+		{"a[i+1]", false},
+		{"x = 1", false},
+		{"$_siginfo", false},
+		{"1x", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsVariable(tt.s); got != tt.ok {
+			t.Errorf("IsVariable(%q) = %v, want %v", tt.s, got, tt.ok)
+		}
+	}
+}
+
+func TestHasControl(t *testing.T) {
+	for s, want := range map[string]bool{"plain text": false, "a\nb": true, "a\rb": true, "\x00": true, "tab\t": true, "ü": false} {
+		if got := HasControl(s); got != want {
+			t.Errorf("HasControl(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
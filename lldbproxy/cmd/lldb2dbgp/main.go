@@ -0,0 +1,64 @@
+// Program lldb2dbgp implements a dbgp to lldb proxy
+//
+// lldb2dbgp [flags] [--] (lldb target) [target args...]
+//
+// note: invoke with the following options to debug: -v=2 -logtostderr
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/traviscline/dbgp/internal/cli"
+	"github.com/traviscline/dbgp/lldbproxy"
+	"os"
+)
+
+var engine = cli.EngineFlags(flag.CommandLine)
+var program = cli.LaunchFlags(flag.CommandLine)
+var target string
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [--] target [args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "No target specified")
+		flag.Usage()
+		os.Exit(1)
+	}
+	target = flag.Args()[0]
+
+	secret, err := engine.Secret()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading secret:", err)
+		os.Exit(1)
+	}
+
+	c, err := engine.Connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error connecting to IDE:", err)
+		os.Exit(1)
+	}
+
+	ideKey, session := os.Getenv("DBGP_IDEKEY"), os.Getenv("DBGP_COOKIE")
+	p, err := lldbproxy.New(target, ideKey, session,
+		lldbproxy.WithArgs(flag.Args()[1:]...),
+		lldbproxy.WithEnv(program.Env...),
+		lldbproxy.WithDir(program.Dir),
+		lldbproxy.WithStdio(program.Stdin, program.Stdout, program.Stderr),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error creating proxy:", err)
+		os.Exit(1)
+	}
+	defer p.Close()
+
+	conn := engine.NewConn(c, p, secret)
+	if err := conn.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error running proxy:", err)
+		p.Close()
+		os.Exit(1)
+	}
+}
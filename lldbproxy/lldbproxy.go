@@ -0,0 +1,455 @@
+// Package lldbproxy implements a dbgp.DBGPClient that is backed by an lldb
+// session, driven through lldb's command interpreter the same way gdbproxy
+// drives gdb
+package lldbproxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/internal/console"
+	"github.com/traviscline/dbgp/internal/launch"
+	"github.com/traviscline/dbgp/internal/policy"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Contexts exposed by the lldb proxy
+const (
+	ContextLocals = iota
+	ContextArguments
+)
+
+var (
+	// frame #1: 0x0000000100003f50 a.out`main at main.c:5:3
+	frameRe = regexp.MustCompile("frame #([0-9]+): 0x[0-9a-fA-F]+ (?:[^`]*`)?(.+?)(?: at (.+?):([0-9]+)(?::[0-9]+)?)?$")
+	// (int) x = 5
+	varRe = regexp.MustCompile(`^\s*\((.+?)\) (\S+) = (.*)$`)
+	// x = 5 (struct members, without a type)
+	memberRe = regexp.MustCompile(`^\s*(\S+) = (.*)$`)
+)
+
+// DefaultTimeout bounds lldb commands other than those resuming the program,
+// which may run for as long as the program does
+var DefaultTimeout = 10 * time.Second
+
+// resuming are the lldb commands that run the program
+var resuming = map[string]bool{
+	"process launch": true, "process continue": true, "thread step-in": true, "thread step-over": true,
+}
+
+// LLDB implements the dbgp.DBGPClient protocol and manages an execution of lldb
+type LLDB struct {
+	status          string // ("starting", "stopping", "running", "break")
+	ideKey, session string
+	features        dbgp.Features
+
+	con        *console.Console
+	policy     *policy.Policy
+	launchArgs string // options appended to "process launch"
+
+	lastStop *dbgp.Message
+}
+
+// Option configures how the debugged program is started
+type Option = launch.Option
+
+// Options of how the debugged program is started
+var (
+	// WithArgs sets the arguments passed to the target program
+	WithArgs = launch.WithArgs
+	// WithEnv sets environment variables ("KEY=VAL") for the target program
+	WithEnv = launch.WithEnv
+	// WithDir sets the working directory of the target program
+	WithDir = launch.WithDir
+	// WithStdio redirects the target program's stdin, stdout and stderr to
+	// the named files. Empty names are left untouched.
+	WithStdio = launch.WithStdio
+)
+
+// New creates a new LLDB DBGP Proxy for the specified target
+func New(target, ideKey, session string, opts ...Option) (*LLDB, error) {
+	o := launch.Apply(opts...)
+	if err := o.Check(); err != nil {
+		return nil, err
+	}
+	var launchFlags []string
+	for _, r := range []struct{ flag, value string }{{"-w", o.Dir}, {"-i", o.Stdin}, {"-o", o.Stdout}, {"-e", o.Stderr}} {
+		if r.value != "" {
+			q, err := quote(r.value)
+			if err != nil {
+				return nil, err
+			}
+			launchFlags = append(launchFlags, r.flag+" "+q)
+		}
+	}
+	settings := []string{"set auto-confirm true", "set stop-line-count-before 0", "set stop-line-count-after 0"}
+	for _, kv := range o.Env {
+		q, err := quote(kv)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, "append target.env-vars "+q)
+	}
+
+	cmd := exec.Command("lldb", append([]string{"--no-use-colors", "--", target}, o.Args...)...)
+	con, err := console.Start(cmd, "(lldb) ")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	if _, err := con.WaitPrompt(ctx); err != nil {
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("waiting for lldb to start: %v", err)
+	}
+
+	l := &LLDB{
+		status:     "starting",
+		ideKey:     ideKey,
+		session:    session,
+		con:        con,
+		policy:     newPolicy(),
+		launchArgs: strings.Join(launchFlags, " "),
+		features:   dbgp.Features{},
+	}
+	for _, setting := range settings {
+		lines, err := l.exec(context.Background(), "settings "+setting)
+		if err == nil {
+			err = lldbError(lines)
+		}
+		if err != nil {
+			cmd.Process.Kill()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// exec sends a command line permitted by the policy and returns its output
+// once lldb prompts again. Commands other than those resuming the program are
+// interrupted after DefaultTimeout, like all commands once ctx is done.
+func (l *LLDB) exec(ctx context.Context, line string) ([]string, error) {
+	if err := l.policy.Check(line); err != nil {
+		glog.Warningln("[lldbproxy]", err)
+		return nil, err
+	}
+	if !resuming[commandName(line)] {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	lines, err := l.con.Command(ctx, line)
+	if err != nil {
+		glog.Warningln("[lldbproxy]", line+":", err)
+	}
+	return lines, err
+}
+
+// commandName returns the lldb command and subcommand of a command line,
+// such as "frame variable"
+func commandName(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) > 2 {
+		fields = fields[:2]
+	}
+	return strings.Join(fields, " ")
+}
+
+// lldbError returns the error printed by lldb, if any
+func lldbError(lines []string) error {
+	for _, l := range lines {
+		if strings.HasPrefix(l, "error: ") {
+			return fmt.Errorf("%s", strings.TrimPrefix(l, "error: "))
+		}
+	}
+	return nil
+}
+
+// Init is invoked to begin the session with the upstream IDE or proxy
+func (l *LLDB) Init(ctx context.Context) (dbgp.InitResponse, error) {
+	fileName, err := l.mainLocation(ctx)
+	if err != nil && ctx.Err() != nil {
+		return dbgp.InitResponse{}, err
+	}
+	lang := languageOf(fileName)
+	l.features.Language_name = lang
+
+	return dbgp.InitResponse{
+		AppID:    "lldbproxy",
+		IDeKey:   l.ideKey,
+		Session:  l.session,
+		Thread:   "1",
+		Language: lang,
+		FileURI:  fileName,
+	}, nil
+}
+
+func (l *LLDB) Status(ctx context.Context) (string, error) {
+	return l.status, nil
+}
+
+func (l *LLDB) Features() dbgp.Features {
+	return l.features
+}
+
+// start launches the program, stopping at main
+func (l *LLDB) start(ctx context.Context) (status, reason string, err error) {
+	if _, err := l.exec(ctx, "breakpoint set --name main"); err != nil {
+		return "", "", err
+	}
+	return l.resume(ctx, l.launchLine())
+}
+
+// launchLine returns the command launching the program
+func (l *LLDB) launchLine() string {
+	return strings.TrimSpace("process launch " + l.launchArgs)
+}
+
+// LastStop describes why the program stopped after the last continuation
+func (l *LLDB) LastStop() *dbgp.Message {
+	return l.lastStop
+}
+
+// resume runs a command resuming the program and updates the status from
+// lldb's stop events. A command stopped by ctx returns ctx's error.
+func (l *LLDB) resume(ctx context.Context, line string) (status, reason string, err error) {
+	if l.status == "stopping" {
+		return "", "", fmt.Errorf("the program is not running")
+	}
+	lines, err := l.exec(ctx, line)
+	glog.V(2).Infoln("[lldbproxy]", line+":", lines)
+	if err != nil {
+		if ctx.Err() != nil {
+			// interrupted, the program stopped wherever it was
+			l.status, _, l.lastStop = stopOf(lines)
+		}
+		return "", "", err
+	}
+	status, reason, l.lastStop = stopOf(lines)
+	if reason == "ok" && l.lastStop == nil {
+		// a refused command leaves the program where it was
+		if err := lldbError(lines); err != nil {
+			return "", "", err
+		}
+	}
+	l.status = status
+	return status, reason, nil
+}
+
+func (l *LLDB) StepInto(ctx context.Context) (status, reason string, err error) {
+	if l.status == "starting" {
+		return l.start(ctx)
+	}
+	return l.resume(ctx, "thread step-in")
+}
+
+func (l *LLDB) StepOver(ctx context.Context) (status, reason string, err error) {
+	if l.status == "starting" {
+		return l.start(ctx)
+	}
+	return l.resume(ctx, "thread step-over")
+}
+
+func (l *LLDB) Run(ctx context.Context) (status, reason string, err error) {
+	if l.status == "starting" {
+		return l.resume(ctx, l.launchLine())
+	}
+	return l.resume(ctx, "process continue")
+}
+
+func (l *LLDB) StackDepth(ctx context.Context) (int, error) {
+	stack, err := l.StackGet(ctx, 0)
+	if err != nil {
+		return 0, err
+	}
+	return len(stack), nil
+}
+
+func (l *LLDB) StackGet(ctx context.Context, depth int) ([]dbgp.Stack, error) {
+	lines, err := l.exec(ctx, "thread backtrace")
+	if err != nil {
+		return nil, err
+	}
+	var stack []dbgp.Stack
+	for _, line := range lines {
+		m := frameRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		level, _ := strconv.Atoi(m[1])
+		lineno, _ := strconv.Atoi(m[4])
+		stack = append(stack, dbgp.Stack{
+			Level:    level,
+			Type:     "file",
+			Filename: m[3],
+			Lineno:   lineno,
+			Where:    m[2],
+		})
+	}
+	if len(stack) == 0 {
+		return nil, fmt.Errorf("no stack frames, is the program running?")
+	}
+	return stack, nil
+}
+
+func (l *LLDB) ContextNames(ctx context.Context, depth int) ([]dbgp.Context, error) {
+	return []dbgp.Context{
+		{Name: "Locals", ID: ContextLocals},
+		{Name: "Arguments", ID: ContextArguments},
+	}, nil
+}
+
+func (l *LLDB) ContextGet(ctx context.Context, depth, context int) ([]dbgp.Property, error) {
+	var flag string
+	switch context {
+	case ContextLocals:
+		flag = "--no-args"
+	case ContextArguments:
+		flag = "--no-locals"
+	default:
+		return nil, dbgp.ErrInvalidOpts
+	}
+	if _, err := l.exec(ctx, fmt.Sprintf("frame select %d", depth)); err != nil {
+		return nil, err
+	}
+	lines, err := l.exec(ctx, "frame variable "+flag)
+	return parseVariables(lines), err
+}
+
+func (l *LLDB) PropertyGet(ctx context.Context, depth, context int, name string) (dbgp.Property, error) {
+	if err := checkVariable(name); err != nil {
+		return dbgp.Property{}, err
+	}
+	if _, err := l.exec(ctx, fmt.Sprintf("frame select %d", depth)); err != nil {
+		return dbgp.Property{}, err
+	}
+	lines, err := l.exec(ctx, "frame variable -- "+name)
+	if err != nil {
+		return dbgp.Property{}, err
+	}
+	properties := parseVariables(lines)
+	if len(properties) == 0 {
+		return dbgp.Property{}, fmt.Errorf("no value for %s: %s", name, strings.Join(lines, "\n"))
+	}
+	p := properties[0]
+	p.Name, p.Fullname = name, name
+	return p, nil
+}
+
+func (l *LLDB) BreakpointSet(ctx context.Context, bpType, fileName string, lineNumber int) (dbgp.Breakpoint, error) {
+	if bpType != "line" {
+		return dbgp.Breakpoint{}, fmt.Errorf("only line breakpoints are supported.")
+	}
+
+	file, err := quote(fileName)
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	lines, err := l.exec(ctx, fmt.Sprintf("breakpoint set --file %s --line %d", file, lineNumber))
+	if err != nil {
+		return dbgp.Breakpoint{}, err
+	}
+	matches, err := console.Extract("Breakpoint ([0-9]+):", strings.Join(lines, "\n"), 1)
+	if err != nil {
+		return dbgp.Breakpoint{}, fmt.Errorf("%s", strings.Join(lines, " "))
+	}
+	bpNum, err := strconv.Atoi(matches[0])
+	return dbgp.Breakpoint{ID: bpNum, State: "enabled"}, err
+}
+
+// Close ends the lldb session, killing the debugged program
+func (l *LLDB) Close() error {
+	l.exec(context.Background(), "process kill")
+	l.con.Send("quit")
+	return l.con.Cmd().Wait()
+}
+
+// Obtain the source file of main via "image lookup"
+func (l *LLDB) mainLocation(ctx context.Context) (string, error) {
+	lines, err := l.exec(ctx, "image lookup --verbose --name main")
+	if err != nil {
+		return "", err
+	}
+	info := strings.Join(lines, "\n")
+	matches, err := console.Extract(`LineEntry: .*?: (.+?):[0-9]+`, info, 1)
+	if err != nil {
+		matches, err = console.Extract("Summary: .* at (.+?):[0-9]+", info, 1)
+	}
+	if err != nil {
+		return "", err
+	}
+	return matches[0], nil
+}
+
+// parseVariables parses the output of "frame variable", where aggregate values
+// span multiple lines enclosed in braces
+func parseVariables(lines []string) []dbgp.Property {
+	var properties []dbgp.Property
+	for i := 0; i < len(lines); i++ {
+		m := varRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		p := dbgp.Property{Name: m[2], Fullname: m[2], Type: m[1]}
+		i = parseValue(&p, m[3], lines, i)
+		properties = append(properties, p)
+	}
+	return properties
+}
+
+// parseValue sets the value or children of p and returns the index of the last
+// line consumed
+func parseValue(p *dbgp.Property, value string, lines []string, i int) int {
+	if value != "{" {
+		p.Value = value
+		return i
+	}
+	for i++; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "}" {
+			break
+		}
+		c := dbgp.Property{}
+		var v string
+		if m := varRe.FindStringSubmatch(lines[i]); m != nil {
+			c.Type, c.Name, v = m[1], m[2], m[3]
+		} else if m := memberRe.FindStringSubmatch(lines[i]); m != nil {
+			c.Name, v = m[1], m[2]
+		} else {
+			continue
+		}
+		if strings.HasPrefix(c.Name, "[") {
+			c.Fullname = p.Fullname + c.Name
+		} else {
+			c.Fullname = p.Fullname + "." + c.Name
+		}
+		i = parseValue(&c, strings.TrimSuffix(v, ","), lines, i)
+		p.Children = append(p.Children, c)
+	}
+	p.NumChildren = len(p.Children)
+	p.HasChildren = p.NumChildren > 0
+	return i
+}
+
+// languageOf guesses the source language from a file name
+func languageOf(fileName string) string {
+	switch filepath.Ext(fileName) {
+	case ".c", ".h":
+		return "c"
+	case ".cc", ".cpp", ".cxx", ".hpp":
+		return "c++"
+	case ".m":
+		return "objective-c"
+	case ".swift":
+		return "swift"
+	case ".rs":
+		return "rust"
+	}
+	return "unknown"
+}
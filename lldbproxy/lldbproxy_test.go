@@ -0,0 +1,76 @@
+package lldbproxy
+
+import (
+	"github.com/traviscline/dbgp"
+	"reflect"
+	"testing"
+)
+
+func TestParseVariables(t *testing.T) {
+	lines := []string{
+		"(int) argc = 1",
+		"(char **) argv = 0x00007fffffffe0a8",
+		"(point) p = {",
+		"  x = 1",
+		"  y = 2",
+		"}",
+		"(int[2]) a = {",
+		"  [0] = 3",
+		"  [1] = 4",
+		"}",
+		"(line) l = {",
+		"  (point) from = {",
+		"    x = 0",
+		"  }",
+		"  to = (x = 5)",
+		"}",
+		"error: unrelated",
+	}
+	want := []dbgp.Property{
+		{Name: "argc", Fullname: "argc", Type: "int", Value: "1"},
+		{Name: "argv", Fullname: "argv", Type: "char **", Value: "0x00007fffffffe0a8"},
+		{Name: "p", Fullname: "p", Type: "point", NumChildren: 2, HasChildren: true, Children: []dbgp.Property{
+			{Name: "x", Fullname: "p.x", Value: "1"},
+			{Name: "y", Fullname: "p.y", Value: "2"},
+		}},
+		{Name: "a", Fullname: "a", Type: "int[2]", NumChildren: 2, HasChildren: true, Children: []dbgp.Property{
+			{Name: "[0]", Fullname: "a[0]", Value: "3"},
+			{Name: "[1]", Fullname: "a[1]", Value: "4"},
+		}},
+		{Name: "l", Fullname: "l", Type: "line", NumChildren: 2, HasChildren: true, Children: []dbgp.Property{
+			{Name: "from", Fullname: "l.from", Type: "point", NumChildren: 1, HasChildren: true, Children: []dbgp.Property{
+				{Name: "x", Fullname: "l.from.x", Value: "0"},
+			}},
+			{Name: "to", Fullname: "l.to", Value: "(x = 5)"},
+		}},
+	}
+	got := parseVariables(lines)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseVariables =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestFrameRe(t *testing.T) {
+	tests := []struct {
+		line                       string
+		level, where, file, lineno string
+	}{
+		{"  * frame #0: 0x0000000100003f50 a.out`main at main.c:5:3", "0", "main", "main.c", "5"},
+		{"    frame #1: 0x00007fff2033bf3d libdyld.dylib`start + 1", "1", "start + 1", "", ""},
+		{"    frame #2: 0x0000555555555131 a.out`f(x=1) at /src/f.c:12", "2", "f(x=1)", "/src/f.c", "12"},
+	}
+	for _, tt := range tests {
+		m := frameRe.FindStringSubmatch(tt.line)
+		if m == nil || m[1] != tt.level || m[2] != tt.where || m[3] != tt.file || m[4] != tt.lineno {
+			t.Errorf("frameRe(%q) = %q", tt.line, m)
+		}
+	}
+}
+
+func TestLanguageOf(t *testing.T) {
+	for file, lang := range map[string]string{"main.c": "c", "a.cpp": "c++", "x.swift": "swift", "lib.rs": "rust", "": "unknown"} {
+		if got := languageOf(file); got != lang {
+			t.Errorf("languageOf(%q) = %q, want %q", file, got, lang)
+		}
+	}
+}
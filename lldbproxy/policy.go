@@ -0,0 +1,49 @@
+package lldbproxy
+
+import (
+	"fmt"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/internal/policy"
+	"strings"
+)
+
+// Everything sent to lldb passes an allowlist of commands, and IDE supplied
+// names and file names are validated before they are interpolated, see
+// package policy.
+
+// allowedSubcommands are the lldb commands issued by the proxy, each
+// restricted to the listed subcommands
+var allowedSubcommands = map[string][]string{
+	"breakpoint": {"set"},
+	"frame":      {"select", "variable"},
+	"image":      {"lookup"},
+	"process":    {"continue", "kill", "launch"},
+	"settings":   {"append", "set"},
+	"thread":     {"backtrace", "step-in", "step-over"},
+}
+
+// newPolicy returns the policy of the lldb commands issued by the proxy
+func newPolicy() *policy.Policy {
+	return policy.New("lldb", nil, allowedSubcommands, nil, nil)
+}
+
+// checkVariable validates an IDE supplied property name. lldb's frame
+// variable only accepts references to variables, which is enforced here so
+// they cannot smuggle options or further commands.
+func checkVariable(name string) error {
+	if name == "" || policy.HasControl(name) {
+		return dbgp.ErrInvalidOpts
+	}
+	if !policy.IsVariable(name) {
+		return fmt.Errorf("%q is not a variable reference", name)
+	}
+	return nil
+}
+
+// quote quotes s as a single lldb command argument
+func quote(s string) (string, error) {
+	if policy.HasControl(s) {
+		return "", fmt.Errorf("control characters in %q", s)
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`, nil
+}
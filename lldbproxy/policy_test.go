@@ -0,0 +1,51 @@
+package lldbproxy
+
+import "testing"
+
+func TestPolicy(t *testing.T) {
+	p := newPolicy()
+	tests := []struct {
+		line string
+		ok   bool
+	}{
+		{`breakpoint set --file "main.c" --line 3`, true},
+		{"frame variable -- x", true},
+		{"process launch", true},
+		{"thread step-in", true},
+		{"platform shell rm -rf ~", false},
+		{"script import os", false},
+		{"command source /tmp/x", false},
+		{"frame variable -- x\nplatform shell id", false},
+		{"process", false},
+	}
+	for _, tt := range tests {
+		if err := p.Check(tt.line); (err == nil) != tt.ok {
+			t.Errorf("Check(%q) = %v, want ok %v", tt.line, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckVariable(t *testing.T) {
+	for name, ok := range map[string]bool{"x": true, "p->next[1]": true, "x\nplatform shell id": false,
+		"-- x": false, "x; y": false, "": false} {
+		if err := checkVariable(name); (err == nil) != ok {
+			t.Errorf("checkVariable(%q) = %v, want ok %v", name, err, ok)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		s, quoted string
+	}{
+		{"main.c", `"main.c"`},
+		{`a "b" \c`, `"a \"b\" \\c"`},
+		{"a\nb", ""},
+	}
+	for _, tt := range tests {
+		got, err := quote(tt.s)
+		if got != tt.quoted || (err == nil) != (tt.quoted != "") {
+			t.Errorf("quote(%q) = %q, %v, want %q", tt.s, got, err, tt.quoted)
+		}
+	}
+}
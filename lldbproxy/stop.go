@@ -0,0 +1,81 @@
+package lldbproxy
+
+import (
+	"github.com/traviscline/dbgp"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Stop events printed by lldb when the program stops
+var (
+	// Process 4242 exited with status = 1 (0x00000001)
+	exitedRe = regexp.MustCompile(`^Process [0-9]+ exited with status = (-?[0-9]+)`)
+	// * thread #1, name = 'a.out', stop reason = breakpoint 1.1
+	stopReasonRe = regexp.MustCompile(`stop reason = (.+)$`)
+	breakpointRe = regexp.MustCompile(`^(?:breakpoint|watchpoint) ([0-9]+)`)
+	// signal SIGSEGV: invalid address (fault address: 0x0), or on macOS
+	// EXC_BAD_ACCESS (code=1, address=0x0)
+	signalRe    = regexp.MustCompile(`^signal (SIG[A-Z0-9]+)(?:: (.+))?$`)
+	exceptionRe = regexp.MustCompile(`^(EXC_[A-Z_]+)(?: (.+))?$`)
+)
+
+// errors of lldb meaning the program is not running
+var notRunning = []string{"invalid process", "Process must be launched", "process launch failed"}
+
+// stopOf derives status, reason and a message from the output of a command
+// resuming the program
+func stopOf(lines []string) (status, reason string, msg *dbgp.Message) {
+	status, reason = "break", "ok"
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if m := exitedRe.FindStringSubmatch(l); m != nil {
+			code, _ := strconv.Atoi(m[1])
+			return "stopping", "ok", &dbgp.Message{ExitCode: &code, Text: l}
+		}
+		if strings.HasPrefix(l, "error: ") {
+			for _, e := range notRunning {
+				if strings.Contains(l, e) {
+					return "stopping", "error", &dbgp.Message{Text: strings.TrimPrefix(l, "error: ")}
+				}
+			}
+		}
+		if m := stopReasonRe.FindStringSubmatch(l); m != nil {
+			reason, msg = stopReason(m[1])
+			continue
+		}
+		if m := frameRe.FindStringSubmatch(l); m != nil && m[1] == "0" && msg != nil && msg.Filename == "" {
+			if path.IsAbs(m[3]) {
+				msg.Filename = m[3]
+				msg.Lineno, _ = strconv.Atoi(m[4])
+			}
+		}
+	}
+	return status, reason, msg
+}
+
+// stopReason returns the reason and message of lldb's stop reason
+func stopReason(s string) (reason string, msg *dbgp.Message) {
+	if m := breakpointRe.FindStringSubmatch(s); m != nil {
+		id, _ := strconv.Atoi(m[1])
+		return "ok", &dbgp.Message{BreakpointID: id, Text: s}
+	}
+	if m := signalRe.FindStringSubmatch(s); m != nil {
+		switch m[1] {
+		case "SIGINT", "SIGSTOP":
+			// interrupted
+			return "aborted", nil
+		}
+		text := m[1]
+		if m[2] != "" {
+			text += ": " + m[2]
+		}
+		return "exception", &dbgp.Message{Exception: m[1], Text: text}
+	}
+	if m := exceptionRe.FindStringSubmatch(s); m != nil {
+		return "exception", &dbgp.Message{Exception: m[1], Text: s}
+	}
+	// steps, "step in", "step over" etc.
+	return "ok", &dbgp.Message{Text: s}
+}
@@ -0,0 +1,74 @@
+package lldbproxy
+
+import (
+	"github.com/traviscline/dbgp"
+	"reflect"
+	"testing"
+)
+
+func TestStopOf(t *testing.T) {
+	zero, one := 0, 1
+	tests := []struct {
+		name           string
+		lines          []string
+		status, reason string
+		msg            *dbgp.Message
+	}{
+		{
+			"breakpoint",
+			[]string{
+				"Process 4242 launched: '/src/a.out' (x86_64)",
+				"Process 4242 stopped",
+				"* thread #1, name = 'a.out', stop reason = breakpoint 1.1",
+				"    frame #0: 0x0000555555555131 a.out`main at /src/main.c:5:3",
+			},
+			"break", "ok", &dbgp.Message{BreakpointID: 1, Text: "breakpoint 1.1", Filename: "/src/main.c", Lineno: 5},
+		},
+		{
+			"step",
+			[]string{"* thread #1, name = 'a.out', stop reason = step over", "    frame #0: 0x1 a.out`main at main.c:6:3"},
+			"break", "ok", &dbgp.Message{Text: "step over"},
+		},
+		{
+			"signal",
+			[]string{"* thread #1, name = 'a.out', stop reason = signal SIGSEGV: invalid address (fault address: 0x0)"},
+			"break", "exception", &dbgp.Message{Exception: "SIGSEGV", Text: "SIGSEGV: invalid address (fault address: 0x0)"},
+		},
+		{
+			"mach exception",
+			[]string{"* thread #1, queue = 'com.apple.main-thread', stop reason = EXC_BAD_ACCESS (code=1, address=0x0)"},
+			"break", "exception", &dbgp.Message{Exception: "EXC_BAD_ACCESS", Text: "EXC_BAD_ACCESS (code=1, address=0x0)"},
+		},
+		{
+			"interrupted",
+			[]string{"Process 4242 stopped", "* thread #1, name = 'a.out', stop reason = signal SIGSTOP"},
+			"break", "aborted", nil,
+		},
+		{
+			"exited",
+			[]string{"Process 4242 resuming", "Process 4242 exited with status = 0 (0x00000000) "},
+			"stopping", "ok", &dbgp.Message{ExitCode: &zero, Text: "Process 4242 exited with status = 0 (0x00000000)"},
+		},
+		{
+			"exited with code",
+			[]string{"Process 4242 exited with status = 1 (0x00000001)"},
+			"stopping", "ok", &dbgp.Message{ExitCode: &one, Text: "Process 4242 exited with status = 1 (0x00000001)"},
+		},
+		{
+			"launch failed",
+			[]string{"error: process launch failed: unable to locate lldb-server"},
+			"stopping", "error", &dbgp.Message{Text: "process launch failed: unable to locate lldb-server"},
+		},
+		{
+			"not running",
+			[]string{"error: invalid process"},
+			"stopping", "error", &dbgp.Message{Text: "invalid process"},
+		},
+	}
+	for _, tt := range tests {
+		status, reason, msg := stopOf(tt.lines)
+		if status != tt.status || reason != tt.reason || !reflect.DeepEqual(msg, tt.msg) {
+			t.Errorf("%s: stopOf = %s, %s, %+v, want %s, %s, %+v", tt.name, status, reason, msg, tt.status, tt.reason, tt.msg)
+		}
+	}
+}
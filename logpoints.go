@@ -0,0 +1,103 @@
+package dbgp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// SplitLogMessage splits the message of a logpoint into literal text and the
+// expressions embedded in braces, e.g. "x is {x}" into "x is ", "" and x.
+// Literal braces are written doubled, as {{ and }}. There is one more literal
+// than there are expressions.
+func SplitLogMessage(message string) (literals, exprs []string, err error) {
+	var lit strings.Builder
+	for i := 0; i < len(message); i++ {
+		switch ch := message[i]; {
+		case ch == '{' && strings.HasPrefix(message[i:], "{{"), ch == '}' && strings.HasPrefix(message[i:], "}}"):
+			lit.WriteByte(ch)
+			i++
+		case ch == '{':
+			end := strings.IndexAny(message[i+1:], "{}")
+			if end < 0 || message[i+1+end] != '}' {
+				return nil, nil, fmt.Errorf("unterminated expression in log message %q", message)
+			}
+			expr := strings.TrimSpace(message[i+1 : i+1+end])
+			if expr == "" {
+				return nil, nil, fmt.Errorf("empty expression in log message %q", message)
+			}
+			literals, exprs = append(literals, lit.String()), append(exprs, expr)
+			lit.Reset()
+			i += end + 1
+		case ch == '}':
+			return nil, nil, fmt.Errorf("unmatched } in log message %q", message)
+		default:
+			lit.WriteByte(ch)
+		}
+	}
+	return append(literals, lit.String()), exprs, nil
+}
+
+// setLogpoint sets a logpoint with the client if it can log the message
+// natively, and otherwise a line breakpoint at which Conn logs the message,
+// evaluating its expressions with the client
+func (c *Conn) setLogpoint(ctx context.Context, fileName string, lineNumber int, message string) (Breakpoint, error) {
+	_, exprs, err := SplitLogMessage(message)
+	if err != nil {
+		return Breakpoint{}, ErrInvalidOpts
+	}
+	if ls, ok := c.client.(LogpointSetter); ok {
+		bp, err := ls.LogpointSet(ctx, fileName, lineNumber, message)
+		switch {
+		case err == nil:
+			c.nativeLogs[bp.ID] = true
+			bp.LogMessage = message
+			return bp, nil
+		case err != ErrUnimplemented:
+			return bp, err
+		}
+		// logged by Conn instead
+	}
+	bm, ok := c.client.(BreakpointManager)
+	if _, ev := c.client.(Evaluator); !ok || !ev && len(exprs) > 0 {
+		return Breakpoint{}, ErrBreakpointType
+	}
+	bp, err := bm.BreakpointSet(ctx, "line", fileName, lineNumber)
+	bp.LogMessage = message
+	return bp, err
+}
+
+// logMessage replaces the expressions of a log message by their values in
+// the current frame. Messages with expressions are only set for Evaluator
+// clients. Expressions that cannot be evaluated are replaced by
+// the error in angle brackets.
+func (c *Conn) logMessage(ctx context.Context, message string) string {
+	literals, exprs, _ := SplitLogMessage(message)
+	var b strings.Builder
+	for i, expr := range exprs {
+		b.WriteString(literals[i])
+		p, err := c.client.(Evaluator).PropertyGet(ctx, 0, 0, expr)
+		if err != nil {
+			b.WriteString("<" + err.Error() + ">")
+			continue
+		}
+		b.WriteString(propertyText(p))
+	}
+	b.WriteString(literals[len(exprs)])
+	return b.String()
+}
+
+// propertyText returns the value of a property as text
+func propertyText(p Property) string {
+	if p.Encoding == "base64" {
+		if v, err := base64.StdEncoding.DecodeString(strings.TrimSpace(p.Value)); err == nil {
+			return string(v)
+		}
+	}
+	if p.Value == "" && p.Type != "" {
+		// structures and arrays have children rather than a value
+		return "{" + p.Type + "}"
+	}
+	return p.Value
+}
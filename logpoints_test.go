@@ -0,0 +1,108 @@
+package dbgp_test
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/traviscline/dbgp"
+	"github.com/traviscline/dbgp/dbgptest"
+	"github.com/traviscline/dbgp/wire"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitLogMessage(t *testing.T) {
+	for _, tt := range []struct {
+		message         string
+		literals, exprs []string
+		err             bool
+	}{
+		{"plain", []string{"plain"}, nil, false},
+		{"", []string{""}, nil, false},
+		{"x is {x}", []string{"x is ", ""}, []string{"x"}, false},
+		{"{x}{y}", []string{"", "", ""}, []string{"x", "y"}, false},
+		{"{ a.b } and { c[1] }!", []string{"", " and ", "!"}, []string{"a.b", "c[1]"}, false},
+		{"{{literal}} {x}", []string{"{literal} ", ""}, []string{"x"}, false},
+		{"}}{{", []string{"}{"}, nil, false},
+		{"{", nil, nil, true},
+		{"{x", nil, nil, true},
+		{"{x{y}}", nil, nil, true},
+		{"}", nil, nil, true},
+		{"{}", nil, nil, true},
+		{"{  }", nil, nil, true},
+	} {
+		literals, exprs, err := dbgp.SplitLogMessage(tt.message)
+		if (err != nil) != tt.err {
+			t.Errorf("SplitLogMessage(%q) error %v, want error %v", tt.message, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(literals, tt.literals) || !reflect.DeepEqual(exprs, tt.exprs) {
+			t.Errorf("SplitLogMessage(%q) = %q, %q, want %q, %q", tt.message, literals, exprs, tt.literals, tt.exprs)
+		}
+	}
+}
+
+// unloggingEngine leaves logging to Conn
+type unloggingEngine struct {
+	*dbgptest.Engine
+}
+
+func (unloggingEngine) LogpointSet(ctx context.Context, fileName string, lineNumber int, message string) (dbgp.Breakpoint, error) {
+	return dbgp.Breakpoint{}, dbgp.ErrUnimplemented
+}
+
+// TestLogpointFallback has Conn log the messages of a client that cannot
+func TestLogpointFallback(t *testing.T) {
+	var stops []dbgptest.Stop
+	for _, x := range []string{"1", "2"} {
+		stops = append(stops, dbgptest.Stop{
+			Message: &dbgp.Message{BreakpointID: 1},
+			Properties: map[dbgptest.Scope][]dbgp.Property{
+				{Depth: 0, Context: 0}: {{Name: "x", Fullname: "x", Type: "int", Value: x}},
+			},
+		})
+	}
+	stops = append(stops, dbgptest.Stop{Message: &dbgp.Message{BreakpointID: 2}})
+	ide, err := dbgptest.NewIDE(unloggingEngine{dbgptest.NewEngine(stops...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ide.Close()
+
+	message := base64.StdEncoding.EncodeToString([]byte("x is {x}"))
+	for _, cmd := range [][]string{
+		{"feature_set", "-n", "notify_ok", "-v", "1"},
+		{"breakpoint_set", "-t", "x_log", "-f", "file:///src/main.c", "-n", "3", "--", message},
+		{"breakpoint_set", "-t", "line", "-f", "file:///src/main.c", "-n", "9"},
+	} {
+		resp, err := ide.Command(cmd[0], cmd[1:]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != nil {
+			t.Fatalf("%q: %v", cmd, resp.Error)
+		}
+	}
+
+	if err := ide.Write([]byte("run -i 9\x00")); err != nil {
+		t.Fatal(err)
+	}
+	var logged []string
+	for {
+		m, err := ide.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, ok := m.(*wire.Notify); ok && n.Name == "x_log" {
+			body := string(n.Body)
+			logged = append(logged, strings.TrimSpace(body[strings.LastIndex(body, ">")+1:]))
+			continue
+		}
+		if _, ok := m.(*wire.Response); ok {
+			break
+		}
+	}
+	if want := []string{"x is 1", "x is 2"}; !reflect.DeepEqual(logged, want) {
+		t.Errorf("logged %q, want %q", logged, want)
+	}
+}
@@ -0,0 +1,189 @@
+package dbgp
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// PathMapping maps a path prefix on the IDE side onto a prefix on the engine
+// side, e.g. IDE "/home/me/work" to engine "/src"
+type PathMapping struct {
+	IDE    string
+	Engine string
+}
+
+// ParsePathMapping parses a mapping of the form "ide=engine"
+func ParsePathMapping(s string) (PathMapping, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return PathMapping{}, fmt.Errorf("invalid path mapping %q, expected ide=engine", s)
+	}
+	return PathMapping{
+		IDE:    normalizePath(s[:i]),
+		Engine: normalizePath(s[i+1:]),
+	}, nil
+}
+
+// PathMap translates filenames between the IDE and the debugger engine. The
+// zero value performs no prefix mapping and only handles file URI
+// encoding/decoding.
+//
+// PathMap implements flag.Value so it can be filled by a repeatable flag.
+type PathMap []PathMapping
+
+func (m *PathMap) String() string {
+	if m == nil {
+		return ""
+	}
+	parts := make([]string, len(*m))
+	for i, pm := range *m {
+		parts[i] = pm.IDE + "=" + pm.Engine
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set adds a mapping of the form "ide=engine"
+func (m *PathMap) Set(s string) error {
+	pm, err := ParsePathMapping(s)
+	if err != nil {
+		return err
+	}
+	*m = append(*m, pm)
+	return nil
+}
+
+// ToEngine converts a file URI (or plain path) received from the IDE into a
+// path on the engine side
+func (m PathMap) ToEngine(uri string) (string, error) {
+	p, err := ParseFileURI(uri)
+	if err != nil {
+		return "", err
+	}
+	return m.translate(p, func(pm PathMapping) (string, string) { return pm.IDE, pm.Engine }), nil
+}
+
+// ToIDE converts an engine side path (or file URI) into a file URI for the IDE.
+// URIs with a scheme other than file are returned unchanged.
+func (m PathMap) ToIDE(p string) string {
+	if p == "" {
+		return ""
+	}
+	if hasNonFileScheme(p) {
+		return p
+	}
+	path, err := ParseFileURI(p)
+	if err != nil {
+		return p
+	}
+	return FileURI(m.translate(path, func(pm PathMapping) (string, string) { return pm.Engine, pm.IDE }))
+}
+
+// translate replaces the longest matching prefix
+func (m PathMap) translate(p string, dir func(PathMapping) (from, to string)) string {
+	var best, replacement string
+	for _, pm := range m {
+		from, to := dir(pm)
+		if hasPathPrefix(p, from) && len(from) > len(best) {
+			best, replacement = from, to
+		}
+	}
+	if best == "" {
+		return p
+	}
+	// the root only ends in a separator
+	rest := strings.TrimSuffix(p, "/")[len(strings.TrimSuffix(best, "/")):]
+	if t := strings.TrimSuffix(replacement, "/") + rest; t != "" {
+		return t
+	}
+	// the root itself
+	return "/"
+}
+
+// FileURI encodes an absolute path as a file URI, escaping as needed.
+// Windows paths such as `C:\src\main.c` become file:///C:/src/main.c
+func FileURI(p string) string {
+	p = normalizePath(p)
+	if isDrivePath(p) {
+		p = "/" + p
+	}
+	u := url.URL{Scheme: "file", Path: p}
+	// url.URL only emits the empty authority for absolute paths
+	if !strings.HasPrefix(p, "/") {
+		return "file:" + u.EscapedPath()
+	}
+	return u.String()
+}
+
+// ParseFileURI decodes a file URI into a path. Plain paths are returned with
+// separators normalized.
+func ParseFileURI(uri string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(uri), "file:") {
+		if hasNonFileScheme(uri) {
+			return "", fmt.Errorf("unsupported URI scheme: %s", uri)
+		}
+		return normalizePath(uri), nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	p := u.Path
+	if u.Host != "" && u.Host != "localhost" {
+		// UNC path
+		p = "//" + u.Host + p
+	}
+	if len(p) > 2 && p[0] == '/' && isDrivePath(p[1:]) {
+		p = p[1:]
+	}
+	return p, nil
+}
+
+// normalizePath uses forward slashes and drops trailing separators
+func normalizePath(p string) string {
+	p = strings.Replace(p, `\`, "/", -1)
+	if len(p) > 1 && !(isDrivePath(p) && len(p) == 3) {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+// hasPathPrefix reports whether prefix is a directory prefix of p. Windows
+// paths compare case insensitively.
+func hasPathPrefix(p, prefix string) bool {
+	if isDrivePath(p) && isDrivePath(prefix) {
+		if len(p) < len(prefix) || !strings.EqualFold(p[:len(prefix)], prefix) {
+			return false
+		}
+		p = prefix + p[len(prefix):]
+	}
+	if prefix == "/" {
+		return strings.HasPrefix(p, "/")
+	}
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// isDrivePath reports whether p starts with a windows drive letter (C:/)
+func isDrivePath(p string) bool {
+	if len(p) < 2 || p[1] != ':' {
+		return false
+	}
+	c := p[0] | 0x20
+	return c >= 'a' && c <= 'z' && (len(p) == 2 || p[2] == '/')
+}
+
+// hasNonFileScheme reports whether s looks like a URI with a scheme other than
+// file, such as dbgp://
+func hasNonFileScheme(s string) bool {
+	i := strings.Index(s, "://")
+	if i <= 0 || isDrivePath(s) || strings.EqualFold(s[:i], "file") {
+		return false
+	}
+	for j, r := range s[:i] {
+		isAlpha := (r|0x20) >= 'a' && (r|0x20) <= 'z'
+		if !isAlpha && (j == 0 || !strings.ContainsRune("0123456789+-.", r)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package dbgp
+
+import "testing"
+
+func TestFileURI(t *testing.T) {
+	tests := []struct {
+		path, uri string
+	}{
+		{"/src/main.c", "file:///src/main.c"},
+		{"/src/with space.c", "file:///src/with%20space.c"},
+		{`C:\src\main.c`, "file:///C:/src/main.c"},
+		{"c:/src", "file:///c:/src"},
+		{"//server/share/main.c", "file:////server/share/main.c"},
+	}
+	for _, tt := range tests {
+		if got := FileURI(tt.path); got != tt.uri {
+			t.Errorf("FileURI(%q) = %q, want %q", tt.path, got, tt.uri)
+		}
+	}
+}
+
+func TestParseFileURI(t *testing.T) {
+	tests := []struct {
+		uri, path string
+		err       bool
+	}{
+		{"file:///src/main.c", "/src/main.c", false},
+		{"file:///src/with%20space.c", "/src/with space.c", false},
+		{"file://localhost/src/main.c", "/src/main.c", false},
+		{"file:///C:/src/main.c", "C:/src/main.c", false},
+		{"FILE:///c:/src", "c:/src", false},
+		{"file://server/share/main.c", "//server/share/main.c", false},
+		{"/src/main.c", "/src/main.c", false},
+		{`C:\src\main.c`, "C:/src/main.c", false},
+		{"/src/dir/", "/src/dir", false},
+		{"dbgp://disasm/main", "", true},
+		{"file:///src/%zz", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFileURI(tt.uri)
+		if (err != nil) != tt.err || got != tt.path {
+			t.Errorf("ParseFileURI(%q) = %q, %v, want %q, error %v", tt.uri, got, err, tt.path, tt.err)
+		}
+	}
+}
+
+func TestPathMap(t *testing.T) {
+	var m PathMap
+	for _, s := range []string{"/home/me/work=/src", `C:\Users\me=/build`, "/home/me/work/vendor=/opt/vendor", "/=/root"} {
+		if err := m.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	toEngine := []struct {
+		uri, path string
+	}{
+		{"file:///home/me/work/main.c", "/src/main.c"},
+		{"file:///home/me/work/vendor/lib.c", "/opt/vendor/lib.c"},
+		{"file:///home/me/workshop/main.c", "/root/home/me/workshop/main.c"},
+		{"file:///c:/users/ME/main.c", "/build/main.c"},
+		{"file:///D:/main.c", "D:/main.c"},
+	}
+	for _, tt := range toEngine {
+		got, err := m.ToEngine(tt.uri)
+		if err != nil || got != tt.path {
+			t.Errorf("ToEngine(%q) = %q, %v, want %q", tt.uri, got, err, tt.path)
+		}
+	}
+	toIDE := []struct {
+		path, uri string
+	}{
+		{"/src/main.c", "file:///home/me/work/main.c"},
+		{"/build/x.c", "file:///C:/Users/me/x.c"},
+		{"/root/etc/hosts", "file:///etc/hosts"},
+		{"dbgp://disasm/main", "dbgp://disasm/main"},
+		{"file:///src/%zz", "file:///src/%zz"},
+		{"", ""},
+	}
+	for _, tt := range toIDE {
+		if got := m.ToIDE(tt.path); got != tt.uri {
+			t.Errorf("ToIDE(%q) = %q, want %q", tt.path, got, tt.uri)
+		}
+	}
+}
+
+func TestParsePathMapping(t *testing.T) {
+	for _, s := range []string{"", "=", "/a=", "=/b"} {
+		if _, err := ParsePathMapping(s); err == nil {
+			t.Errorf("ParsePathMapping(%q) succeeded", s)
+		}
+	}
+	pm, err := ParsePathMapping(`C:\a=b\`)
+	if err != nil || pm != (PathMapping{"C:/a", "b"}) {
+		t.Errorf("ParsePathMapping = %+v, %v", pm, err)
+	}
+}
+
+func TestPathMapRoot(t *testing.T) {
+	m := PathMap{{IDE: "/", Engine: "/chroot"}}
+	if got := m.ToIDE("/chroot"); got != "file:///" {
+		t.Errorf("ToIDE(/chroot) = %q", got)
+	}
+	if got, _ := m.ToEngine("file:///"); got != "/chroot" {
+		t.Errorf("ToEngine(file:///) = %q", got)
+	}
+}
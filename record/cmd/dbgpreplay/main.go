@@ -0,0 +1,90 @@
+// Program dbgpreplay replays a session recorded with -record against a DBGP
+// engine and reports the packets that differ from the recording
+//
+// dbgpreplay [flags] session.jsonl [--] [engine command...]
+//
+// The engine command, if given, is started after listening and should
+// connect to the -listen address, e.g.:
+//
+// dbgpreplay session.jsonl -- gdb2dbgp -dial localhost:9000 ./binary
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/traviscline/dbgp/record"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var listen = flag.String("listen", "localhost:9000", "address to accept the engine's connection on")
+var ignore = flag.String("ignore", strings.Join(record.Ignore, ","), "comma separated init/response attributes left out of comparisons")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] session.jsonl [--] [engine command...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "No session specified")
+		flag.Usage()
+		os.Exit(1)
+	}
+	record.Ignore = strings.Split(*ignore, ",")
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening session:", err)
+		os.Exit(1)
+	}
+	entries, err := record.ReadLog(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading session:", err)
+		os.Exit(1)
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error listening:", err)
+		os.Exit(1)
+	}
+	engine := flag.Args()[1:]
+	if len(engine) > 0 && engine[0] == "--" {
+		engine = engine[1:]
+	}
+	var cmd *exec.Cmd
+	if len(engine) > 0 {
+		cmd = exec.Command(engine[0], engine[1:]...)
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error starting engine:", err)
+			os.Exit(1)
+		}
+	}
+
+	c, err := l.Accept()
+	l.Close()
+	var diffs []record.Diff
+	if err == nil {
+		diffs, err = record.Replay(entries, c)
+		c.Close()
+	}
+	if cmd != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error replaying session:", err)
+	}
+	if err != nil || len(diffs) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("ok:", len(entries), "packets replayed")
+}
@@ -0,0 +1,148 @@
+// Package record records the packets of DBGP sessions and replays recorded
+// sessions against engines, so protocol issues can be captured once and turned
+// into regression tests.
+//
+// Sessions are stored as JSON lines, one Entry per packet.
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Direction of a recorded packet
+const (
+	FromIDE    = "ide"    // a command sent by the IDE
+	FromEngine = "engine" // an init, response, stream or notify packet sent by the engine
+)
+
+// Entry is a single recorded packet
+type Entry struct {
+	Dir  string    `json:"dir"`
+	Time time.Time `json:"time"`
+	Data string    `json:"data"` // without framing: the command line or the XML document
+}
+
+// Recorder is an io.ReadWriter for the engine side of a DBGP connection that
+// records every command read and every packet written. Wrap the connection
+// handed to dbgp.NewConn with it.
+type Recorder struct {
+	rw io.ReadWriter
+
+	mu      sync.Mutex // guards everything below
+	log     io.Writer
+	enc     *json.Encoder
+	in, out []byte // incomplete commands and packets
+	err     error
+}
+
+// NewRecorder records the traffic of rw to log
+func NewRecorder(rw io.ReadWriter, log io.Writer) *Recorder {
+	return &Recorder{rw: rw, log: log, enc: json.NewEncoder(log)}
+}
+
+func (r *Recorder) Read(p []byte) (int, error) {
+	n, err := r.rw.Read(p)
+	if n > 0 {
+		r.mu.Lock()
+		r.in = append(r.in, p[:n]...)
+		r.commands()
+		r.mu.Unlock()
+	}
+	return n, err
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	n, err := r.rw.Write(p)
+	if n > 0 {
+		r.mu.Lock()
+		r.out = append(r.out, p[:n]...)
+		r.packets()
+		r.mu.Unlock()
+	}
+	return n, err
+}
+
+// commands records the complete, NUL terminated commands read so far
+func (r *Recorder) commands() {
+	for {
+		i := bytes.IndexByte(r.in, 0)
+		if i < 0 {
+			return
+		}
+		r.record(FromIDE, r.in[:i])
+		r.in = r.in[i+1:]
+	}
+}
+
+// packets records the complete packets written so far
+func (r *Recorder) packets() {
+	for {
+		i := bytes.IndexByte(r.out, 0)
+		if i < 0 {
+			return
+		}
+		length, err := strconv.Atoi(string(r.out[:i]))
+		if err != nil || length < 0 {
+			// not framed, keep what was written
+			r.record(FromEngine, r.out[:i])
+			r.out = r.out[i+1:]
+			continue
+		}
+		end := i + 1 + length
+		if len(r.out) <= end {
+			return
+		}
+		r.record(FromEngine, r.out[i+1:end])
+		r.out = r.out[end+1:]
+	}
+}
+
+func (r *Recorder) record(dir string, data []byte) {
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(Entry{Dir: dir, Time: time.Now(), Data: string(data)})
+}
+
+// Err returns the first error writing to the log
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close closes the connection and the log, if they are io.Closers
+func (r *Recorder) Close() error {
+	var err error
+	if c, ok := r.rw.(io.Closer); ok {
+		err = c.Close()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.log.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ReadLog reads a recorded session
+func ReadLog(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	dec := json.NewDecoder(r)
+	for {
+		var e Entry
+		if err := dec.Decode(&e); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
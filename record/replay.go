@@ -0,0 +1,157 @@
+package record
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/traviscline/dbgp/wire"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ignore lists the root element attributes left out of comparisons because
+// they differ between runs of the same session
+var Ignore = []string{"appid", "idekey", "session", "thread", "x_challenge"}
+
+// Timeout bounds how long Replay waits for a packet on connections with read
+// deadlines
+var Timeout = 10 * time.Second
+
+// Diff is a packet the engine sent differently than recorded
+type Diff struct {
+	Command string // the command the packet followed, empty for the init packet
+	Want    string // canonical form of the recorded packet
+	Got     string // canonical form of the replayed packet, empty if missing
+}
+
+func (d Diff) String() string {
+	cmd := d.Command
+	if cmd == "" {
+		cmd = "(init)"
+	}
+	return fmt.Sprintf("%s\n- %s\n+ %s", cmd, d.Want, d.Got)
+}
+
+// Replay plays back the IDE side of a recorded session against the engine on
+// the other end of rw, comparing the engine's packets with the recorded ones.
+// After each command Replay reads as many packets as were recorded after it.
+func Replay(entries []Entry, rw io.ReadWriter) ([]Diff, error) {
+	f := wire.NewFramer(rw)
+	var (
+		diffs   []Diff
+		command string
+		want    []string
+	)
+	// compare reads a packet for each of want
+	compare := func() error {
+		for _, w := range want {
+			got, err := readPacket(f, rw)
+			if err == io.EOF {
+				diffs = append(diffs, Diff{command, canonical(w), ""})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if c := canonical(w); c != canonical(string(got)) {
+				diffs = append(diffs, Diff{command, c, canonical(string(got))})
+			}
+		}
+		want = want[:0]
+		return nil
+	}
+
+	for _, e := range entries {
+		switch e.Dir {
+		case FromEngine:
+			want = append(want, e.Data)
+		case FromIDE:
+			if err := compare(); err != nil {
+				return diffs, err
+			}
+			command = e.Data
+			if err := f.WriteCommand(e.Data); err != nil {
+				return diffs, err
+			}
+		default:
+			return diffs, fmt.Errorf("unknown direction %q", e.Dir)
+		}
+	}
+	err := compare()
+	return diffs, err
+}
+
+// readPacket reads a packet, with a deadline if conn supports it
+func readPacket(f *wire.Framer, conn io.Reader) ([]byte, error) {
+	if d, ok := conn.(interface {
+		SetReadDeadline(time.Time) error
+	}); ok {
+		d.SetReadDeadline(time.Now().Add(Timeout))
+	}
+	return f.ReadPacket()
+}
+
+// canonical formats a packet so that equivalent packets compare equal:
+// attributes are sorted, the XML declaration and indentation are dropped and
+// the Ignore attributes of the root element are removed. Packets that are not
+// well formed are returned as is.
+func canonical(data string) string {
+	var (
+		b     bytes.Buffer
+		depth int
+	)
+	d := xml.NewDecoder(strings.NewReader(data))
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			return b.String()
+		}
+		if err != nil {
+			return data
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			attrs := make([]string, 0, len(t.Attr))
+			for _, a := range t.Attr {
+				if depth == 0 && ignored(a.Name.Local) {
+					continue
+				}
+				var v bytes.Buffer
+				xml.EscapeText(&v, []byte(a.Value))
+				attrs = append(attrs, name(a.Name)+`="`+v.String()+`"`)
+			}
+			sort.Strings(attrs)
+			b.WriteString("<" + name(t.Name))
+			for _, a := range attrs {
+				b.WriteString(" " + a)
+			}
+			b.WriteString(">")
+			depth++
+		case xml.EndElement:
+			b.WriteString("</" + name(t.Name) + ">")
+			depth--
+		case xml.CharData:
+			if s := strings.TrimSpace(string(t)); s != "" {
+				xml.EscapeText(&b, []byte(s))
+			}
+		}
+	}
+}
+
+func name(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+func ignored(attr string) bool {
+	for _, a := range Ignore {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
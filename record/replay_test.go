@@ -0,0 +1,24 @@
+package record
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+	for _, tt := range []struct{ a, b string }{
+		{
+			`<?xml version="1.0"?><init appid="1" language="go" x_challenge="ab"></init>`,
+			`<init x_challenge="cd" language="go" appid="2"/>`,
+		},
+		{
+			`<response command="status" transaction_id="1" status="break"/>`,
+			"<response\n status=\"break\" transaction_id=\"1\" command=\"status\">\n</response>",
+		},
+	} {
+		if a, b := canonical(tt.a), canonical(tt.b); a != b {
+			t.Errorf("canonical differs:\n%s\n%s", a, b)
+		}
+	}
+	// volatile attributes are only ignored on the root element
+	if a, b := canonical(`<r><p session="1"/></r>`), canonical(`<r><p session="2"/></r>`); a == b {
+		t.Errorf("nested attributes ignored: %s", a)
+	}
+}
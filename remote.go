@@ -0,0 +1,457 @@
+package dbgp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/traviscline/dbgp/wire"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Remote is a DBGPClient backed by a debugger engine on the other end of a
+// DBGP connection. It plays the IDE side of the protocol, so engines such as
+// gdb2dbgp or Xdebug can be driven by other frontends.
+//
+// Filenames are converted between the engine's file URIs and plain paths.
+type Remote struct {
+	f    *wire.Framer
+	txID int
+
+	init      InitResponse
+	challenge string // x_challenge of the init packet
+	features  Features
+	lastStop  *Message
+	streams   map[string]io.Writer // redirected streams by type
+	notes     []Notification       // notify packets received while waiting
+	wmu       sync.Mutex           // serializes commands with a break
+}
+
+// NewRemote reads the engine's init packet from rw and returns a client for it
+func NewRemote(rw io.ReadWriter) (*Remote, error) {
+	r := &Remote{f: wire.NewFramer(rw)}
+	m, err := r.f.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	init, ok := m.(*wire.Init)
+	if !ok {
+		return nil, fmt.Errorf("expected init packet, got %q", m.Packet())
+	}
+	r.init = InitResponse{
+		AppID:    init.AppID,
+		IDeKey:   init.IDEKey,
+		Session:  init.Session,
+		Thread:   init.Thread,
+		Parent:   init.Parent,
+		Language: init.Language,
+		FileURI:  init.FileURI,
+	}
+	r.challenge, _ = init.Attr("x_challenge")
+	if p, err := ParseFileURI(r.init.FileURI); err == nil {
+		r.init.FileURI = p
+	}
+	r.features.Language_name = r.init.Language
+	return r, nil
+}
+
+// remoteResponse holds the union of all response payloads
+type remoteResponse struct {
+	XMLName      xml.Name      `xml:"response"`
+	Status       string        `xml:"status,attr"`
+	Reason       string        `xml:"reason,attr"`
+	Depth        int           `xml:"depth,attr"`
+	ID           int           `xml:"id,attr"`
+	BreakpointID int           `xml:"breakpoint_id,attr"`
+	State        string        `xml:"state,attr"`
+	Supported    string        `xml:"supported,attr"`
+	Success      int           `xml:"success,attr"`
+	Hardware     Bool          `xml:"x_hardware,attr"`
+	Stack        []Stack       `xml:"stack"`
+	Contexts     []Context     `xml:"context"`
+	Properties   []Property    `xml:"property"`
+	Message      *Message      `xml:"message"`
+	Instructions []Instruction `xml:"instruction"`
+	Text         string        `xml:",chardata"`
+}
+
+// breakpointID returns the id of the breakpoint set, which engines report as
+// id or as breakpoint_id
+func (r *remoteResponse) breakpointID() int {
+	if r.ID != 0 {
+		return r.ID
+	}
+	return r.BreakpointID
+}
+
+// Authenticate answers the engine's challenge with the shared secret. It must
+// be called before any other command if the engine requires authentication.
+func (r *Remote) Authenticate(secret string) error {
+	if r.challenge == "" {
+		return fmt.Errorf("engine sent no challenge")
+	}
+	response := AuthResponse(secret, r.challenge, r.init.IDeKey, r.init.Session)
+	_, err := r.command(context.Background(), "x_auth", "--", base64.StdEncoding.EncodeToString([]byte(response)))
+	return err
+}
+
+func (r *Remote) Init(ctx context.Context) (InitResponse, error) {
+	return r.init, nil
+}
+
+func (r *Remote) Status(ctx context.Context) (string, error) {
+	resp, err := r.command(ctx, "status")
+	if err != nil {
+		return "", err
+	}
+	return resp.Status, nil
+}
+
+func (r *Remote) Features() Features {
+	return r.features
+}
+
+func (r *Remote) StepInto(ctx context.Context) (status, reason string, err error) {
+	return r.continuation(ctx, "step_into")
+}
+
+func (r *Remote) StepOver(ctx context.Context) (status, reason string, err error) {
+	return r.continuation(ctx, "step_over")
+}
+
+func (r *Remote) Run(ctx context.Context) (status, reason string, err error) {
+	return r.continuation(ctx, "run")
+}
+
+// StepIntoInstruction executes one instruction with the
+// x_step_into_instruction extension
+func (r *Remote) StepIntoInstruction(ctx context.Context) (status, reason string, err error) {
+	return r.continuation(ctx, "x_step_into_instruction")
+}
+
+// StepOverInstruction executes one instruction with the
+// x_step_over_instruction extension
+func (r *Remote) StepOverInstruction(ctx context.Context) (status, reason string, err error) {
+	return r.continuation(ctx, "x_step_over_instruction")
+}
+
+// StepIntoBack steps backwards with the x_step_into_back extension
+func (r *Remote) StepIntoBack(ctx context.Context) (status, reason string, err error) {
+	return r.continuation(ctx, "x_step_into_back")
+}
+
+// StepOverBack steps backwards with the x_step_over_back extension
+func (r *Remote) StepOverBack(ctx context.Context) (status, reason string, err error) {
+	return r.continuation(ctx, "x_step_over_back")
+}
+
+// StepOutBack runs backwards to the caller with the x_step_out_back extension
+func (r *Remote) StepOutBack(ctx context.Context) (status, reason string, err error) {
+	return r.continuation(ctx, "x_step_out_back")
+}
+
+// RunBack runs backwards with the x_run_back extension
+func (r *Remote) RunBack(ctx context.Context) (status, reason string, err error) {
+	return r.continuation(ctx, "x_run_back")
+}
+
+// Disassemble disassembles a function with the x_disasm extension
+func (r *Remote) Disassemble(ctx context.Context, function string) ([]Instruction, error) {
+	args := []string{}
+	if function != "" {
+		args = append(args, "-n", function)
+	}
+	resp, err := r.command(ctx, "x_disasm", args...)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Instructions, nil
+}
+
+func (r *Remote) continuation(ctx context.Context, cmd string) (status, reason string, err error) {
+	resp, err := r.command(ctx, cmd)
+	if err != nil {
+		r.lastStop = nil
+		return "", "", err
+	}
+	r.lastStop = resp.Message
+	if m := r.lastStop; m != nil && m.Filename != "" {
+		if p, err := ParseFileURI(m.Filename); err == nil {
+			m.Filename = p
+		}
+	}
+	return resp.Status, resp.Reason, nil
+}
+
+// LastStop returns the engine's message about the last stop, if it sent one
+func (r *Remote) LastStop() *Message {
+	return r.lastStop
+}
+
+func (r *Remote) StackDepth(ctx context.Context) (int, error) {
+	resp, err := r.command(ctx, "stack_depth")
+	if err != nil {
+		return 0, err
+	}
+	return resp.Depth, nil
+}
+
+func (r *Remote) StackGet(ctx context.Context, depth int) ([]Stack, error) {
+	resp, err := r.command(ctx, "stack_get", "-d", strconv.Itoa(depth))
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range resp.Stack {
+		if p, err := ParseFileURI(s.Filename); err == nil {
+			resp.Stack[i].Filename = p
+		}
+	}
+	return resp.Stack, nil
+}
+
+func (r *Remote) ContextNames(ctx context.Context, depth int) ([]Context, error) {
+	resp, err := r.command(ctx, "context_names", "-d", strconv.Itoa(depth))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Contexts, nil
+}
+
+func (r *Remote) ContextGet(ctx context.Context, depth, context int) ([]Property, error) {
+	resp, err := r.command(ctx, "context_get", "-d", strconv.Itoa(depth), "-c", strconv.Itoa(context))
+	if err != nil {
+		return nil, err
+	}
+	decodeProperties(resp.Properties)
+	return resp.Properties, nil
+}
+
+func (r *Remote) PropertyGet(ctx context.Context, depth, context int, name string) (Property, error) {
+	resp, err := r.command(ctx, "property_get", "-d", strconv.Itoa(depth), "-c", strconv.Itoa(context), "-n", name)
+	if err != nil {
+		return Property{}, err
+	}
+	if len(resp.Properties) == 0 {
+		return Property{}, fmt.Errorf("no property in response")
+	}
+	decodeProperties(resp.Properties)
+	return resp.Properties[0], nil
+}
+
+func (r *Remote) BreakpointSet(ctx context.Context, bpType, fileName string, line int) (Breakpoint, error) {
+	resp, err := r.command(ctx, "breakpoint_set", "-t", bpType, "-f", FileURI(fileName), "-n", strconv.Itoa(line))
+	if err != nil {
+		return Breakpoint{}, err
+	}
+	return Breakpoint{ID: resp.breakpointID(), State: resp.State}, nil
+}
+
+// BreakpointRemove removes a breakpoint with breakpoint_remove
+func (r *Remote) BreakpointRemove(ctx context.Context, id int) error {
+	_, err := r.command(ctx, "breakpoint_remove", "-d", strconv.Itoa(id))
+	return err
+}
+
+// PropertySet sets a property with property_set
+func (r *Remote) PropertySet(ctx context.Context, depth, context int, name, value string) error {
+	_, err := r.command(ctx, "property_set", "-d", strconv.Itoa(depth), "-c", strconv.Itoa(context), "-n", name,
+		"--", base64.StdEncoding.EncodeToString([]byte(value)))
+	return err
+}
+
+// Source returns the contents of an engine side file with the source command
+func (r *Remote) Source(ctx context.Context, fileName string) ([]byte, error) {
+	resp, err := r.command(ctx, "source", "-f", FileURI(fileName))
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(resp.Text))
+}
+
+// RedirectStream redirects stdout or stderr of the engine. The stream packets
+// are written to w as they arrive while waiting for responses, so the output
+// of a running program shows up once the engine answers run or a step.
+func (r *Remote) RedirectStream(ctx context.Context, stream string, mode int, w io.Writer) error {
+	if stream != "stdout" && stream != "stderr" {
+		return ErrInvalidOpts
+	}
+	if _, err := r.command(ctx, stream, "-c", strconv.Itoa(mode)); err != nil {
+		return err
+	}
+	if r.streams == nil {
+		r.streams = make(map[string]io.Writer)
+	}
+	if mode == 0 {
+		delete(r.streams, stream)
+	} else {
+		r.streams[stream] = w
+	}
+	return nil
+}
+
+// ExceptionBreakpointSet sets a breakpoint on the named exception
+func (r *Remote) ExceptionBreakpointSet(ctx context.Context, name string) (Breakpoint, error) {
+	resp, err := r.command(ctx, "breakpoint_set", "-t", "exception", "-x", name)
+	if err != nil {
+		return Breakpoint{}, err
+	}
+	return Breakpoint{ID: resp.breakpointID(), State: resp.State}, nil
+}
+
+// WatchpointSet sets a watch breakpoint on an expression
+func (r *Remote) WatchpointSet(ctx context.Context, bpType, expression string) (Breakpoint, error) {
+	resp, err := r.command(ctx, "breakpoint_set", "-t", bpType, "--", base64.StdEncoding.EncodeToString([]byte(expression)))
+	if err != nil {
+		return Breakpoint{}, err
+	}
+	return Breakpoint{ID: resp.breakpointID(), State: resp.State, Hardware: bool(resp.Hardware)}, nil
+}
+
+// FeatureSet sets a feature of the engine, e.g. notify_ok to receive
+// notifications
+func (r *Remote) FeatureSet(ctx context.Context, name, value string) error {
+	resp, err := r.command(ctx, "feature_set", "-n", name, "-v", value)
+	if err != nil {
+		return err
+	}
+	if resp.Success != 1 {
+		return fmt.Errorf("feature %s not supported", name)
+	}
+	return nil
+}
+
+// Notifications returns the notify packets the engine sent since the last
+// call, which it only does after FeatureSet(ctx, "notify_ok", "1")
+func (r *Remote) Notifications() []Notification {
+	notes := r.notes
+	r.notes = nil
+	return notes
+}
+
+// ReadMemory reads memory of the program with the x_memory_read extension
+func (r *Remote) ReadMemory(ctx context.Context, address uint64, size int) ([]byte, error) {
+	resp, err := r.command(ctx, "x_memory_read", "-a", fmt.Sprintf("0x%x", address), "-s", strconv.Itoa(size))
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(resp.Text))
+}
+
+// command sends a command and waits for its response, skipping stream and
+// notify packets. If ctx is done while waiting, the engine is sent a break
+// and ctx's error is returned once the command is answered.
+func (r *Remote) command(ctx context.Context, name string, args ...string) (*remoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.txID++
+	parts := []string{name, "-i", strconv.Itoa(r.txID)}
+	for _, a := range args {
+		parts = append(parts, quoteArg(a))
+	}
+	if err := r.write(parts); err != nil {
+		return nil, err
+	}
+
+	var (
+		mu       sync.Mutex
+		answered bool // the command returned, ctx may be cancelled by now
+	)
+	done := make(chan struct{})
+	defer func() {
+		mu.Lock()
+		answered = true
+		mu.Unlock()
+		close(done)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			defer mu.Unlock()
+			if answered {
+				return
+			}
+			if err := r.write([]string{"break", "-i", "0"}); err != nil {
+				glog.Warningln("[remote] break:", err)
+			}
+		case <-done:
+		}
+	}()
+
+	for {
+		m, err := r.f.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		glog.V(2).Infoln("[remote] <-", string(m.Packet()))
+		if s, ok := m.(*wire.Stream); ok {
+			if w := r.streams[s.Type]; w != nil {
+				w.Write(s.Data)
+			}
+			continue
+		}
+		if n, ok := m.(*wire.Notify); ok {
+			r.notes = append(r.notes, decodeNotification(n))
+			continue
+		}
+		resp, ok := m.(*wire.Response)
+		if !ok || resp.TransactionID != r.txID {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, dbgpError{resp.Error.Code, resp.Error.Message}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		decoded := new(remoteResponse)
+		if err := xml.Unmarshal(resp.Packet(), decoded); err != nil {
+			return nil, err
+		}
+		return decoded, nil
+	}
+}
+
+// write sends a command, break is written while another command is pending
+func (r *Remote) write(parts []string) error {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	glog.V(2).Infoln("[remote] ->", parts)
+	return r.f.WriteCommand(strings.Join(parts, " "))
+}
+
+// decodeNotification decodes a notify packet as sent by Conn
+func decodeNotification(n *wire.Notify) Notification {
+	var body struct {
+		Breakpoint struct {
+			ID int `xml:"id,attr"`
+		} `xml:"breakpoint"`
+		Text string `xml:",chardata"`
+	}
+	// the body holds the children only, wrap it for unmarshaling
+	xml.Unmarshal(append(append([]byte("<notify>"), n.Body...), "</notify>"...), &body)
+	return Notification{Name: n.Name, BreakpointID: body.Breakpoint.ID, Text: strings.TrimSpace(body.Text)}
+}
+
+// decodeProperties decodes base64 encoded values in place
+func decodeProperties(properties []Property) {
+	for i := range properties {
+		p := &properties[i]
+		p.XMLName = xml.Name{}
+		if len(p.Children) > 0 {
+			// only indentation
+			p.Value = strings.TrimSpace(p.Value)
+		}
+		if p.Encoding == "base64" {
+			if b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(p.Value)); err == nil {
+				p.Value, p.Encoding = string(b), ""
+			}
+		}
+		decodeProperties(p.Children)
+	}
+}
@@ -0,0 +1,188 @@
+// Package transport establishes DBGP connections, optionally over TLS with
+// client certificates and certificate pinning.
+//
+// DBGP gives the IDE full control over the engine, which for gdb includes
+// running shell commands, so connections crossing a network should be
+// encrypted and authenticated in both directions.
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// Config configures TLS. The zero value, or a nil *Config, means plain TCP.
+type Config struct {
+	// TLS enables TLS even if none of the other fields are set, verifying
+	// servers against the system roots
+	TLS bool
+
+	// CertFile and KeyFile hold the PEM encoded certificate presented to the
+	// peer: the server certificate when listening, the client certificate
+	// when dialing
+	CertFile, KeyFile string
+
+	// CAFile holds PEM encoded certificates the peer's certificate must
+	// chain to. When listening, it makes client certificates mandatory.
+	CAFile string
+
+	// Pins are base64 encoded SHA-256 hashes of the DER encoded public keys
+	// (SubjectPublicKeyInfo) of certificates, as printed by
+	//
+	//	openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+	//
+	// If set, a certificate of the peer must match: one of its verified chain
+	// with CAFile, and otherwise its own certificate, in which case pinning
+	// replaces the verification of the chain, which allows self signed
+	// certificates.
+	Pins []string
+
+	// ServerName overrides the name the server certificate is verified
+	// against, by default the host being dialed
+	ServerName string
+}
+
+func (c *Config) enabled() bool {
+	return c != nil && (c.TLS || c.CertFile != "" || c.CAFile != "" || len(c.Pins) > 0)
+}
+
+// TLSConfig returns the TLS configuration for a server or a client
+func (c *Config) TLSConfig(server bool) (*tls.Config, error) {
+	tc := &tls.Config{ServerName: c.ServerName, MinVersion: tls.VersionTLS12}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	if server && len(tc.Certificates) == 0 {
+		return nil, errors.New("transport: listening with TLS requires a certificate")
+	}
+
+	var pool *x509.CertPool
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("transport: no certificates in %s", c.CAFile)
+		}
+	}
+	pins := make(map[string]bool, len(c.Pins))
+	for _, p := range c.Pins {
+		if b, err := base64.StdEncoding.DecodeString(p); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("transport: invalid pin %q", p)
+		}
+		pins[p] = true
+	}
+
+	if server {
+		switch {
+		case pool != nil:
+			tc.ClientCAs = pool
+			tc.ClientAuth = tls.RequireAndVerifyClientCert
+		case len(pins) > 0:
+			tc.ClientAuth = tls.RequireAnyClientCert
+		}
+	} else {
+		tc.RootCAs = pool
+		if pool == nil && len(pins) > 0 {
+			// the pins are checked instead
+			tc.InsecureSkipVerify = true
+		}
+	}
+	if len(pins) > 0 {
+		tc.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			matches := func(cert *x509.Certificate) bool {
+				sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				return pins[base64.StdEncoding.EncodeToString(sum[:])]
+			}
+			if pool == nil {
+				// the chain is not verified, only the leaf proved to hold
+				// its key in the handshake
+				if len(rawCerts) == 0 {
+					return errors.New("transport: the peer sent no certificate")
+				}
+				cert, err := x509.ParseCertificate(rawCerts[0])
+				if err != nil {
+					return err
+				}
+				if matches(cert) {
+					return nil
+				}
+			}
+			for _, chain := range verifiedChains {
+				for _, cert := range chain {
+					if matches(cert) {
+						return nil
+					}
+				}
+			}
+			return errors.New("transport: no certificate of the peer matches a pin")
+		}
+	}
+	return tc, nil
+}
+
+// Dial connects to addr, typically the IDE
+func Dial(addr string, c *Config) (net.Conn, error) {
+	if !c.enabled() {
+		return net.Dial("tcp", addr)
+	}
+	tc, err := c.TLSConfig(false)
+	if err != nil {
+		return nil, err
+	}
+	if tc.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			tc.ServerName = host
+		}
+	}
+	conn, err := tls.Dial("tcp", addr, tc)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Listen listens for connections on addr
+func Listen(addr string, c *Config) (net.Listener, error) {
+	if !c.enabled() {
+		return net.Listen("tcp", addr)
+	}
+	tc, err := c.TLSConfig(true)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", addr, tc)
+}
+
+// Flags registers -tls, -tls-cert, -tls-key, -tls-ca, -tls-pin and
+// -tls-server-name on fs, returning the Config they fill in
+func Flags(fs *flag.FlagSet) *Config {
+	c := new(Config)
+	fs.BoolVar(&c.TLS, "tls", false, "use TLS (implied by the other -tls flags)")
+	fs.StringVar(&c.CertFile, "tls-cert", "", "PEM certificate file, the client certificate when dialing")
+	fs.StringVar(&c.KeyFile, "tls-key", "", "PEM private key file for -tls-cert")
+	fs.StringVar(&c.CAFile, "tls-ca", "", "PEM file of CAs to verify the peer with, required for client certificates when listening")
+	fs.Var((*pinList)(&c.Pins), "tls-pin", "base64 SHA-256 of a public key the peer's certificate must have (repeatable)")
+	fs.StringVar(&c.ServerName, "tls-server-name", "", "name to verify the server certificate against")
+	return c
+}
+
+// pinList is a repeatable string flag
+type pinList []string
+
+func (l *pinList) String() string     { return strings.Join(*l, ",") }
+func (l *pinList) Set(s string) error { *l = append(*l, s); return nil }
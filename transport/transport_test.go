@@ -0,0 +1,207 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a self signed certificate for 127.0.0.1 in PEM files
+type testCert struct {
+	certFile, keyFile string
+	pin               string
+}
+
+func newTestCert(t *testing.T, dir, name string) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testCert{
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+"-key.pem"),
+	}
+	if err := ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	c.pin = base64.StdEncoding.EncodeToString(sum[:])
+	return c
+}
+
+func TestInvalidPin(t *testing.T) {
+	for _, pin := range []string{
+		"",
+		"not base64!",
+		base64.StdEncoding.EncodeToString(make([]byte, sha256.Size-1)),
+		base64.StdEncoding.EncodeToString(make([]byte, sha256.Size+1)),
+	} {
+		c := &Config{Pins: []string{pin}}
+		if _, err := c.TLSConfig(false); err == nil {
+			t.Errorf("pin %q accepted", pin)
+		}
+	}
+	c := &Config{Pins: []string{base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))}}
+	if _, err := c.TLSConfig(false); err != nil {
+		t.Errorf("valid pin rejected: %v", err)
+	}
+}
+
+func TestPins(t *testing.T) {
+	dir := t.TempDir()
+	server := newTestCert(t, dir, "server")
+	client := newTestCert(t, dir, "client")
+	other := newTestCert(t, dir, "other")
+	// other's certificate followed by the pinned ones, which are public
+	smuggled := filepath.Join(dir, "smuggled.pem")
+	var chain []byte
+	for _, f := range []string{other.certFile, server.certFile, client.certFile} {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, b...)
+	}
+	if err := ioutil.WriteFile(smuggled, chain, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name           string
+		server, client Config
+		ok             bool
+	}{
+		{
+			name:   "client pins server",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile},
+			client: Config{Pins: []string{server.pin}},
+			ok:     true,
+		},
+		{
+			name:   "client pins another key",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile},
+			client: Config{Pins: []string{other.pin}},
+		},
+		{
+			name:   "client pins one of several",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile},
+			client: Config{Pins: []string{other.pin, server.pin}},
+			ok:     true,
+		},
+		{
+			name:   "pinned certificate after an unpinned leaf",
+			server: Config{CertFile: smuggled, KeyFile: other.keyFile},
+			client: Config{Pins: []string{server.pin}},
+		},
+		{
+			name:   "server pins client, pinned certificate after an unpinned leaf",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile, Pins: []string{client.pin}},
+			client: Config{CertFile: smuggled, KeyFile: other.keyFile, Pins: []string{server.pin}},
+		},
+		{
+			name:   "self signed without pin",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile},
+			client: Config{TLS: true},
+		},
+		{
+			name:   "CA and pin",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile},
+			client: Config{CAFile: server.certFile, Pins: []string{server.pin}},
+			ok:     true,
+		},
+		{
+			name:   "CA and another pin",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile},
+			client: Config{CAFile: server.certFile, Pins: []string{other.pin}},
+		},
+		{
+			name:   "server pins client",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile, Pins: []string{client.pin}},
+			client: Config{CertFile: client.certFile, KeyFile: client.keyFile, Pins: []string{server.pin}},
+			ok:     true,
+		},
+		{
+			name:   "server pins client, no client certificate",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile, Pins: []string{client.pin}},
+			client: Config{Pins: []string{server.pin}},
+		},
+		{
+			name:   "server pins client, another client certificate",
+			server: Config{CertFile: server.certFile, KeyFile: server.keyFile, Pins: []string{client.pin}},
+			client: Config{CertFile: other.certFile, KeyFile: other.keyFile, Pins: []string{server.pin}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := handshake(t, &tt.server, &tt.client); (err == nil) != tt.ok {
+				t.Errorf("handshake error %v, want success %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+// handshake connects client to server and reads a byte written by the
+// server once its handshake completed
+func handshake(t *testing.T, server, client *Config) error {
+	l, err := Listen("127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if err := conn.(*tls.Conn).Handshake(); err == nil {
+			conn.Write([]byte{1})
+		}
+	}()
+
+	conn, err := Dial(l.Addr().String(), client)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	return err
+}
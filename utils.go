@@ -1,9 +1,31 @@
 package dbgp
 
 import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
 	"reflect"
 )
 
 func getFieldValueByName(obj interface{}, fieldName string) (interface{}, error) {
-	return reflect.ValueOf(obj).FieldByName(fieldName), nil
+	v := reflect.ValueOf(obj).FieldByName(fieldName)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("no field %s", fieldName)
+	}
+	return v.Interface(), nil
+}
+
+// escapes s for use as XML character data
+func escapeText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// boolInt returns 1 for true and 0 for false, as DBGP encodes booleans
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
 }
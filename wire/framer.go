@@ -0,0 +1,147 @@
+// Package wire implements the DBGP framing shared by engines and IDEs: NUL
+// terminated commands from the IDE and length prefixed, NUL terminated XML
+// packets from the engine, decoded into typed messages.
+package wire
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// DefaultMaxSize is the largest packet or command a Framer accepts unless
+// configured otherwise
+const DefaultMaxSize = 32 << 20
+
+// ErrTooLarge is returned for packets and commands longer than MaxSize. The
+// offending data is skipped, so reading can continue.
+var ErrTooLarge = errors.New("wire: packet or command too large")
+
+// Framer reads and writes DBGP packets and commands
+type Framer struct {
+	r *bufio.Reader
+	w *bufio.Writer
+
+	// MaxSize limits the size of packets and commands read, DefaultMaxSize
+	// if zero
+	MaxSize int
+}
+
+// NewFramer creates a framer communicating over rw
+func NewFramer(rw io.ReadWriter) *Framer {
+	return &Framer{r: bufio.NewReader(rw), w: bufio.NewWriter(rw)}
+}
+
+func (f *Framer) maxSize() int {
+	if f.MaxSize > 0 {
+		return f.MaxSize
+	}
+	return DefaultMaxSize
+}
+
+// ReadPacket reads an engine packet, returning the XML document without
+// framing. The declared length must be a decimal number not exceeding
+// MaxSize and be followed by exactly that many bytes and a NUL.
+func (f *Framer) ReadPacket() ([]byte, error) {
+	length, err := f.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if length > f.maxSize() {
+		if _, err := f.r.Discard(length + 1); err != nil {
+			return nil, err
+		}
+		return nil, ErrTooLarge
+	}
+	b := make([]byte, length+1)
+	if _, err := io.ReadFull(f.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if b[length] != 0 {
+		return nil, fmt.Errorf("wire: packet of declared length %d not NUL terminated", length)
+	}
+	return b[:length], nil
+}
+
+// readLength reads the NUL terminated length prefix of a packet
+func (f *Framer) readLength() (int, error) {
+	maxDigits := len(strconv.Itoa(f.maxSize())) + 1
+	var digits []byte
+	for {
+		c, err := f.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(digits) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if c == 0 {
+			break
+		}
+		if c < '0' || c > '9' || len(digits) == maxDigits {
+			return 0, fmt.Errorf("wire: invalid packet length %q", append(digits, c))
+		}
+		digits = append(digits, c)
+	}
+	if len(digits) == 0 {
+		return 0, errors.New("wire: empty packet length")
+	}
+	return strconv.Atoi(string(digits))
+}
+
+// WritePacket frames and writes an XML document
+func (f *Framer) WritePacket(b []byte) error {
+	f.w.WriteString(strconv.Itoa(len(b)))
+	f.w.WriteByte(0)
+	f.w.Write(b)
+	f.w.WriteByte(0)
+	return f.w.Flush()
+}
+
+// ReadCommand reads an IDE command, without the terminating NUL
+func (f *Framer) ReadCommand() (string, error) {
+	var cmd []byte
+	tooLarge := false
+	for {
+		b, err := f.r.ReadSlice(0)
+		if !tooLarge {
+			cmd = append(cmd, b...)
+			if len(cmd) > f.maxSize()+1 {
+				// keep reading up to the NUL to stay in sync
+				tooLarge, cmd = true, nil
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && (len(cmd) > 0 || tooLarge):
+			return "", io.ErrUnexpectedEOF
+		case err != nil:
+			return "", err
+		case tooLarge:
+			return "", ErrTooLarge
+		}
+		return string(cmd[:len(cmd)-1]), nil
+	}
+}
+
+// WriteCommand writes an IDE command, appending the terminating NUL
+func (f *Framer) WriteCommand(cmd string) error {
+	f.w.WriteString(cmd)
+	f.w.WriteByte(0)
+	return f.w.Flush()
+}
+
+// ReadMessage reads and decodes an engine packet
+func (f *Framer) ReadMessage() (Message, error) {
+	b, err := f.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+	return Decode(b)
+}
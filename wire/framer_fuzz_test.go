@@ -0,0 +1,85 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+// initPacket is a valid init packet as sent by an engine
+const initPacket = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+	`<init xmlns="urn:debugger_protocol_v1" appid="1" idekey="key" language="go" protocol_version="1.0" fileuri="file:///src/main.go"></init>`
+
+// FuzzFramer reads arbitrary bytes as packets, messages and commands,
+// checking that the limits hold and that written packets read back unchanged
+func FuzzFramer(f *testing.F) {
+	for _, seed := range []string{
+		strconv.Itoa(len(initPacket)) + "\x00" + initPacket + "\x00",
+		"5\x00hello\x00",
+		"3\x00abcd\x00",
+		"99999999999999999999\x00",
+		"-1\x00\x00",
+		"\x00",
+		"12",         // truncated length prefix
+		"5\x00hello", // missing NUL
+		"4\x00ab",    // truncated packet
+		"cmd -i 1",   // command missing its NUL
+		"cmd -i 1\x00cmd -i 2\x00",
+		"property_set -i 1 -n x -- !!!*\x00", // bad base64 after --
+		"53\x00<stream type=\"stdout\" encoding=\"base64\">!!!*</stream>\x00",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		const max = 1 << 10
+		read := func(next func(*Framer) (int, error)) {
+			fr := NewFramer(struct {
+				io.Reader
+				io.Writer
+			}{bytes.NewReader(data), ioutil.Discard})
+			fr.MaxSize = max
+			for i := 0; i <= len(data); i++ {
+				n, err := next(fr)
+				if err == ErrTooLarge {
+					continue
+				}
+				if err != nil {
+					return
+				}
+				if n > max {
+					t.Fatalf("read %d bytes, more than MaxSize %d", n, max)
+				}
+			}
+		}
+		read(func(fr *Framer) (int, error) {
+			b, err := fr.ReadPacket()
+			if err != nil {
+				return 0, err
+			}
+			// malformed packets leave the framer in sync
+			if m, err := Decode(b); err == nil && m != nil && !bytes.Equal(m.Packet(), b) {
+				t.Fatalf("decoded %q from %q", m.Packet(), b)
+			}
+			return len(b), nil
+		})
+		read(func(fr *Framer) (int, error) {
+			s, err := fr.ReadCommand()
+			return len(s), err
+		})
+
+		var buf bytes.Buffer
+		fr := NewFramer(&buf)
+		if err := fr.WritePacket(data); err != nil {
+			t.Fatal(err)
+		}
+		b, err := fr.ReadPacket()
+		if err != nil {
+			t.Fatalf("reading written packet: %v", err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("read %q, wrote %q", b, data)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// readAll collects what next returns until an error other than ErrTooLarge
+func readAll(next func() (string, error)) (got []string, err error) {
+	for {
+		s, err := next()
+		if err == ErrTooLarge {
+			got = append(got, "<too large>")
+			continue
+		}
+		if err != nil {
+			return got, err
+		}
+		got = append(got, s)
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []string
+		err  string // prefix of the final error
+	}{
+		{"", nil, "EOF"},
+		{"5\x00hello\x00", []string{"hello"}, "EOF"},
+		{"5\x00hello\x003\x00abc\x00", []string{"hello", "abc"}, "EOF"},
+		{"0\x00\x00", []string{""}, "EOF"},
+		{"11\x00" + strings.Repeat("a", 11) + "\x002\x00ok\x00", []string{"<too large>", "ok"}, "EOF"},
+		{"12", nil, "unexpected EOF"},
+		{"5\x00hel", nil, "unexpected EOF"},
+		{"5\x00hello", nil, "unexpected EOF"},
+		{"3\x00abcd\x00", nil, "wire: packet of declared length 3 not NUL terminated"},
+		{"\x00", nil, "wire: empty packet length"},
+		{"-1\x00\x00", nil, `wire: invalid packet length "-"`},
+		{"1x\x00", nil, `wire: invalid packet length "1x"`},
+		{"123456\x00", nil, `wire: invalid packet length "1234`},
+	} {
+		f := NewFramer(struct {
+			io.Reader
+			io.Writer
+		}{strings.NewReader(tt.in), ioutil.Discard})
+		f.MaxSize = 10
+		got, err := readAll(func() (string, error) {
+			b, err := f.ReadPacket()
+			return string(b), err
+		})
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("ReadPacket(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("ReadPacket(%q) error %q, want %q", tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []string
+		err  error
+	}{
+		{"", nil, io.EOF},
+		{"run -i 1\x00", []string{"run -i 1"}, io.EOF},
+		{"a\x00\x00b\x00", []string{"a", "", "b"}, io.EOF},
+		{"0123456789\x00", []string{"0123456789"}, io.EOF},
+		{"0123456789a\x00ok\x00", []string{"<too large>", "ok"}, io.EOF},
+		{strings.Repeat("a", 5000) + "\x00ok\x00", []string{"<too large>", "ok"}, io.EOF},
+		{"status -i 1", nil, io.ErrUnexpectedEOF},
+		{strings.Repeat("a", 5000), nil, io.ErrUnexpectedEOF},
+	} {
+		f := NewFramer(struct {
+			io.Reader
+			io.Writer
+		}{strings.NewReader(tt.in), ioutil.Discard})
+		f.MaxSize = 10
+		got, err := readAll(f.ReadCommand)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("ReadCommand(%.20q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if err != tt.err {
+			t.Errorf("ReadCommand(%.20q) error %v, want %v", tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	f := NewFramer(&buf)
+	if err := f.WritePacket([]byte("<init/>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.WriteCommand("status -i 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "7\x00<init/>\x00status -i 1\x00"; got != want {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	for _, tt := range []struct {
+		packet string
+		check  func(Message) bool
+		err    bool
+	}{
+		{
+			`<init xmlns="urn:debugger_protocol_v1" appid="1" language="go" fileuri="file:///main.go"/>`,
+			func(m Message) bool { i, ok := m.(*Init); return ok && i.AppID == "1" && i.Language == "go" },
+			false,
+		},
+		{
+			`<response xmlns="urn:debugger_protocol_v1" command="status" transaction_id="3" status="break"/>`,
+			func(m Message) bool { r, ok := m.(*Response); return ok && r.TransactionID == 3 },
+			false,
+		},
+		{
+			`<stream type="stdout" encoding="base64">aGk=</stream>`,
+			func(m Message) bool { s, ok := m.(*Stream); return ok && s.Type == "stdout" && string(s.Data) == "hi" },
+			false,
+		},
+		{`<stream type="stdout" encoding="base64">!!!*</stream>`, nil, true},
+		{`<notify name="breakpoint_resolved"/>`, func(m Message) bool { _, ok := m.(*Notify); return ok }, false},
+		{`<bogus/>`, nil, true},
+		{`<response`, nil, true},
+	} {
+		var buf bytes.Buffer
+		f := NewFramer(&buf)
+		f.WritePacket([]byte(tt.packet))
+		m, err := f.ReadMessage()
+		if tt.err {
+			if err == nil {
+				t.Errorf("ReadMessage(%q) succeeded, want an error", tt.packet)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadMessage(%q): %v", tt.packet, err)
+			continue
+		}
+		if !tt.check(m) {
+			t.Errorf("ReadMessage(%q) = %+v", tt.packet, m)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Namespace of DBGP packets
+const Namespace = "urn:debugger_protocol_v1"
+
+// Message is a decoded engine packet: *Init, *Response, *Stream or *Notify
+type Message interface {
+	// Packet returns the XML document the message was decoded from
+	Packet() []byte
+}
+
+// Init is the packet an engine sends upon connecting
+type Init struct {
+	XMLName         xml.Name
+	Attrs           []xml.Attr `xml:"-"` // all attributes
+	AppID           string     `xml:"appid,attr"`
+	IDEKey          string     `xml:"idekey,attr"`
+	Session         string     `xml:"session,attr"`
+	Thread          string     `xml:"thread,attr"`
+	Parent          string     `xml:"parent,attr"`
+	Language        string     `xml:"language,attr"`
+	ProtocolVersion string     `xml:"protocol_version,attr"`
+	FileURI         string     `xml:"fileuri,attr"`
+
+	raw []byte
+}
+
+// Response answers an IDE command. The command specific payload is left in
+// Body for decoding into the types of the command.
+type Response struct {
+	XMLName       xml.Name
+	Attrs         []xml.Attr `xml:"-"` // all attributes
+	Command       string     `xml:"command,attr"`
+	TransactionID int        `xml:"transaction_id,attr"`
+	Status        string     `xml:"status,attr"`
+	Reason        string     `xml:"reason,attr"`
+	Error         *Error     `xml:"error"`
+	Body          []byte     `xml:",innerxml"`
+
+	raw []byte
+}
+
+// Error is the error element of a response
+type Error struct {
+	Code    int    `xml:"code,attr"`
+	Message string `xml:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// Stream carries output of the debugged program
+type Stream struct {
+	XMLName  xml.Name
+	Type     string `xml:"type,attr"` // stdout or stderr
+	Encoding string `xml:"encoding,attr"`
+	Text     string `xml:",chardata"`
+	Data     []byte `xml:"-"` // Text decoded
+
+	raw []byte
+}
+
+// Notify is an asynchronous notification, its payload is left in Body
+type Notify struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:"-"` // all attributes
+	Name    string     `xml:"name,attr"`
+	Body    []byte     `xml:",innerxml"`
+
+	raw []byte
+}
+
+func (m *Init) Packet() []byte     { return m.raw }
+func (m *Response) Packet() []byte { return m.raw }
+func (m *Stream) Packet() []byte   { return m.raw }
+func (m *Notify) Packet() []byte   { return m.raw }
+
+// Attr returns the value of the named attribute and whether it is present
+func (m *Init) Attr(name string) (string, bool) { return attr(m.Attrs, name) }
+
+// Attr returns the value of the named attribute and whether it is present
+func (m *Response) Attr(name string) (string, bool) { return attr(m.Attrs, name) }
+
+// Attr returns the value of the named attribute and whether it is present
+func (m *Notify) Attr(name string) (string, bool) { return attr(m.Attrs, name) }
+
+func attr(attrs []xml.Attr, name string) (string, bool) {
+	for _, a := range attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// Decode decodes an engine packet by its root element
+func Decode(b []byte) (Message, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("wire: decoding packet: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "init":
+			m := &Init{raw: b, Attrs: start.Attr}
+			return m, decodeElement(d, m, &start)
+		case "response":
+			m := &Response{raw: b, Attrs: start.Attr}
+			return m, decodeElement(d, m, &start)
+		case "stream":
+			m := &Stream{raw: b}
+			if err := decodeElement(d, m, &start); err != nil {
+				return m, err
+			}
+			m.Data = []byte(m.Text)
+			if m.Encoding == "base64" {
+				if m.Data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(m.Text)); err != nil {
+					return m, fmt.Errorf("wire: decoding stream: %v", err)
+				}
+			}
+			return m, nil
+		case "notify":
+			m := &Notify{raw: b, Attrs: start.Attr}
+			return m, decodeElement(d, m, &start)
+		}
+		return nil, fmt.Errorf("wire: unknown packet <%s>", start.Name.Local)
+	}
+}
+
+func decodeElement(d *xml.Decoder, v interface{}, start *xml.StartElement) error {
+	if err := d.DecodeElement(v, start); err != nil {
+		return fmt.Errorf("wire: decoding <%s>: %v", start.Name.Local, err)
+	}
+	return nil
+}